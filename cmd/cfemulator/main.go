@@ -0,0 +1,72 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command cfemulator serves the in-memory Cloudflare API emulator, for
+// running the controller against it in e2e tests.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare/cfemulator"
+)
+
+// listFlag collects a repeatable flag.
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func main() {
+	var addr, token string
+	var zones, tunnels listFlag
+	flag.StringVar(&addr, "bind-address", ":8787", "The address the emulator listens on.")
+	flag.StringVar(&token, "token", "", "Only accept this API token. Any credentials are accepted when empty.")
+	flag.Var(&zones, "zone", "A zone to create as <zone-id>=<name>. Can be repeated.")
+	flag.Var(&tunnels, "tunnel", "A tunnel to create as <account-id>/<tunnel-id>=<name>. Can be repeated.")
+	flag.Parse()
+
+	emu := cfemulator.New()
+	if token != "" {
+		emu.RequireToken(token)
+	}
+	for _, z := range zones {
+		id, name, ok := strings.Cut(z, "=")
+		if !ok {
+			log.Fatalf("invalid --zone %q, want <zone-id>=<name>", z)
+		}
+		emu.AddZone(id, name)
+	}
+	for _, t := range tunnels {
+		ref, name, ok := strings.Cut(t, "=")
+		account, id, ok2 := strings.Cut(ref, "/")
+		if !ok || !ok2 {
+			log.Fatalf("invalid --tunnel %q, want <account-id>/<tunnel-id>=<name>", t)
+		}
+		emu.AddTunnel(account, id, name)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(cfemulator.AdminPath, emu.AdminHandler())
+	mux.Handle("/", emu)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("Serving the Cloudflare API emulator on %s", addr)
+	log.Fatal(server.ListenAndServe())
+}
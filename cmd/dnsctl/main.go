@@ -0,0 +1,146 @@
+/*
+Copyright 2026.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command dnsctl lists the DNS records deleted by the controller and restores
+// them through the restore annotation of their source ConfigMap.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/history"
+)
+
+const usage = `Usage:
+  dnsctl history [flags]                          list deleted records
+  dnsctl restore [flags] --source ns/name HOST... restore deleted records
+
+Flags:
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	namespace := fs.String("namespace", "cloudflared", "The namespace of the history ConfigMap.")
+	name := fs.String("configmap", "cloudflared-dns-history", "The name of the history ConfigMap.")
+	source := fs.String("source", "", "Only records deleted by this ConfigMap, as namespace/name.")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(os.Args[2:])
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, err := client.New(cfg, client.Options{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	store := history.NewStore(c, types.NamespacedName{Namespace: *namespace, Name: *name}, 0)
+	entries, err := store.List(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch os.Args[1] {
+	case "history":
+		printHistory(entries, *source)
+	case "restore":
+		if *source == "" || fs.NArg() == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if err := restore(ctx, c, entries, *source, fs.Args()); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func printHistory(entries []history.Entry, source string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DELETED\tSOURCE\tHOSTNAME\tTYPE\tCONTENT\tPROXIED\tTTL")
+	for _, e := range entries {
+		if source != "" && e.Source != source {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%d\n",
+			e.Time.Format(time.RFC3339), e.Source, e.Name, e.Type, e.Content, e.Proxied, e.TTL)
+	}
+	_ = w.Flush()
+}
+
+// restore adds hostnames to the restore annotation of source, so the
+// controller recreates their last deleted records and keeps them.
+func restore(ctx context.Context, c client.Client, entries []history.Entry, source string, hostnames []string) error {
+	ns, name, ok := strings.Cut(source, "/")
+	if !ok {
+		return fmt.Errorf("invalid --source %q, want namespace/name", source)
+	}
+	for _, hostname := range hostnames {
+		if _, found := history.Latest(entries, source, hostname); !found {
+			return fmt.Errorf("no deleted record of %s from %s", hostname, source)
+		}
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, cm); err != nil {
+		return err
+	}
+	patch := client.MergeFrom(cm.DeepCopy())
+	var pending []string
+	for hostname := range strings.SplitSeq(cm.Annotations[history.RestoreAnnotation], ",") {
+		if hostname = strings.TrimSpace(hostname); hostname != "" {
+			pending = append(pending, hostname)
+		}
+	}
+	for _, hostname := range hostnames {
+		if !slices.Contains(pending, hostname) {
+			pending = append(pending, hostname)
+		}
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[history.RestoreAnnotation] = strings.Join(pending, ",")
+	if err := c.Patch(ctx, cm, patch); err != nil {
+		return err
+	}
+	fmt.Printf("Restoring %s from %s\n", strings.Join(hostnames, ", "), source)
+	return nil
+}
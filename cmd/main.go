@@ -17,27 +17,41 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	"golang.org/x/time/rate"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/audit"
 	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+	"github.com/seipan/cloudflared-dns-controller/pkg/config"
 	"github.com/seipan/cloudflared-dns-controller/pkg/controller"
+	"github.com/seipan/cloudflared-dns-controller/pkg/credentials"
+	"github.com/seipan/cloudflared-dns-controller/pkg/health"
+	"github.com/seipan/cloudflared-dns-controller/pkg/history"
+	"github.com/seipan/cloudflared-dns-controller/pkg/notify"
+	"github.com/seipan/cloudflared-dns-controller/pkg/tracing"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -61,7 +75,25 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
-	var targetName, targetNamespace, targetKey string
+	var configFile, authMode, apiTokenFile, zoneIDFile string
+	var targetName, targetNamespace, targetKey, targetLabelSelector, zoneID string
+	var requeueInterval, requeueBaseDelay, requeueMaxDelay, recordCacheTTL, accessCheckInterval time.Duration
+	var resyncJitter, requeueQPS, cloudflareQPS float64
+	var requeueBurst, maxConcurrentReconciles, cloudflareBurst int
+	var defaultProxied, batchChanges, allowSecretRefs bool
+	var batchSize, applyConcurrency int
+	var deletionGracePeriod time.Duration
+	var requireApproval, autoApproveCreates bool
+	var defaultTTL int
+	var commentPrefix string
+	var cloudflareBaseURL, cloudflareProxyURL, cloudflareCAFile, userAgentSuffix string
+	var cloudflareRequestTimeout time.Duration
+	var tracingEndpoint string
+	var tracingInsecure bool
+	var tracingSampleRatio float64
+	var auditFile string
+	var historyConfigMap string
+	var historyLimit int
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -80,12 +112,95 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&configFile, "config", "",
+		"Path to the controller configuration file. Flags set explicitly override values from the file.")
 	flag.StringVar(&targetName, "target-name", "cloudflared",
 		"The name of the target ConfigMap to watch.")
 	flag.StringVar(&targetNamespace, "target-namespace", "cloudflared",
 		"The namespace of the target ConfigMap to watch.")
 	flag.StringVar(&targetKey, "target-key", "config.yaml",
-		"The key in the target ConfigMap that contains the cloudflared config.")
+		"Comma-separated keys or globs in the target ConfigMap that contain cloudflared configs. "+
+			"Falls back to config.yaml, config.yml or config.json when none match.")
+	flag.StringVar(&targetLabelSelector, "target-label-selector", "",
+		"Only watch the target ConfigMap while it matches this label selector, ex app=cloudflared.")
+	flag.StringVar(&zoneID, "zone-id", "",
+		"The Cloudflare zone ID to manage records in. Overrides CLOUDFLARE_ZONE_ID.")
+	flag.StringVar(&authMode, "auth-mode", "token",
+		"How to authenticate against Cloudflare: token (CLOUDFLARE_API_TOKEN), or apiKey for a Global API Key "+
+			"read from CLOUDFLARE_API_KEY and CLOUDFLARE_EMAIL.")
+	flag.StringVar(&apiTokenFile, "api-token-file", "",
+		"A file holding the Cloudflare API token, such as a mounted Secret. Takes precedence over CLOUDFLARE_API_TOKEN "+
+			"and is reloaded when it changes.")
+	flag.StringVar(&zoneIDFile, "zone-id-file", "",
+		"A file holding the Cloudflare zone ID. Takes precedence over --zone-id and is reloaded when it changes.")
+	flag.BoolVar(&allowSecretRefs, "allow-secret-refs", false,
+		"Let the target ConfigMap name a Secret in its namespace with its own api-token and zone-id "+
+			"through the credentials-secret annotation. Requires RBAC to watch Secrets.")
+	flag.DurationVar(&requeueInterval, "requeue-interval", 5*time.Minute,
+		"How often each ConfigMap is resynced against Cloudflare.")
+	flag.Float64Var(&resyncJitter, "resync-jitter", 0.1,
+		"Spread each resync randomly over up to this fraction of --requeue-interval, from 0 to 1.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"The maximum number of ConfigMaps reconciled at the same time.")
+	flag.DurationVar(&requeueBaseDelay, "requeue-base-delay", 5*time.Millisecond,
+		"The initial backoff before a failed reconcile is retried.")
+	flag.DurationVar(&requeueMaxDelay, "requeue-max-delay", 1000*time.Second,
+		"The maximum backoff before a failed reconcile is retried.")
+	flag.Float64Var(&requeueQPS, "requeue-qps", 10,
+		"The overall rate of retries for failed reconciles.")
+	flag.IntVar(&requeueBurst, "requeue-burst", 100,
+		"The burst size of retries for failed reconciles.")
+	flag.Float64Var(&cloudflareQPS, "cloudflare-qps", 4,
+		"The maximum rate of Cloudflare API requests shared by all reconciles. 0 disables the limit.")
+	flag.IntVar(&cloudflareBurst, "cloudflare-burst", 10,
+		"The burst size of Cloudflare API requests.")
+	flag.StringVar(&cloudflareBaseURL, "cloudflare-base-url", "",
+		"Send Cloudflare API requests to this Cloudflare-compatible base URL, ex http://localhost:8787/client/v4.")
+	flag.StringVar(&cloudflareProxyURL, "cloudflare-proxy-url", "",
+		"The HTTP proxy for Cloudflare API requests. Defaults to HTTPS_PROXY.")
+	flag.StringVar(&cloudflareCAFile, "cloudflare-ca-file", "",
+		"A PEM bundle trusted in addition to the system roots, such as the CA of an egress proxy.")
+	flag.DurationVar(&cloudflareRequestTimeout, "cloudflare-request-timeout", 0,
+		"The timeout of each Cloudflare API request attempt. 0 disables it.")
+	flag.StringVar(&userAgentSuffix, "user-agent-suffix", "",
+		"Appended to the User-Agent of Cloudflare API requests.")
+	flag.StringVar(&tracingEndpoint, "tracing-endpoint", "",
+		"The OTLP/gRPC endpoint to export traces to, ex http://otel-collector:4317. "+
+			"Tracing is disabled unless this or OTEL_EXPORTER_OTLP_ENDPOINT is set.")
+	flag.BoolVar(&tracingInsecure, "tracing-insecure", false,
+		"Export traces without TLS.")
+	flag.Float64Var(&tracingSampleRatio, "tracing-sample-ratio", 1,
+		"The fraction of reconciles traced, between 0 and 1.")
+	flag.StringVar(&auditFile, "audit-file", "",
+		"Append an audit record of every DNS change as a JSON line to this file.")
+	flag.StringVar(&historyConfigMap, "history-configmap", "cloudflared-dns-history",
+		"The ConfigMap in the target namespace keeping snapshots of deleted DNS records.")
+	flag.IntVar(&historyLimit, "history-limit", 100,
+		"How many deleted DNS records the history keeps. 0 disables it.")
+	flag.DurationVar(&recordCacheTTL, "record-cache-ttl", time.Minute,
+		"How long a listing of the zone's DNS records is reused across reconciles. 0 disables the cache.")
+	flag.DurationVar(&accessCheckInterval, "access-check-interval", 5*time.Minute,
+		"How often the Cloudflare token and zone access are verified for the readiness probe. 0 disables the check. "+
+			"DNS Write is only verified for tokens that also have API Tokens Read.")
+	flag.BoolVar(&batchChanges, "batch-changes", false,
+		"Apply record changes through Cloudflare's DNS batch endpoint, falling back to one request per record.")
+	flag.IntVar(&batchSize, "batch-size", 200,
+		"The maximum number of record changes sent in one batch request.")
+	flag.DurationVar(&deletionGracePeriod, "deletion-grace-period", 0,
+		"How long a hostname must be absent from the ingress before its DNS record is deleted. 0 deletes it right away.")
+	flag.BoolVar(&requireApproval, "require-approval", false,
+		"Apply record updates and deletes only once their plan hash is set in the approved-plan annotation.")
+	flag.BoolVar(&autoApproveCreates, "auto-approve-creates", false,
+		"Apply record creates without approval when --require-approval is set.")
+	flag.IntVar(&applyConcurrency, "apply-concurrency", 4,
+		"The number of record changes applied at once when they are not batched. "+
+			"All calls still share the Cloudflare rate limit.")
+	flag.BoolVar(&defaultProxied, "default-proxied", true,
+		"Whether records are proxied through Cloudflare unless overridden per hostname.")
+	flag.IntVar(&defaultTTL, "default-ttl", 1,
+		"The TTL of records unless overridden per hostname. 1 means automatic and is required for proxied records.")
+	flag.StringVar(&commentPrefix, "comment-prefix", "",
+		"A prefix added to the comment of every record.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -94,6 +209,123 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	controllerConfig := config.DefaultControllerConfig()
+	if configFile != "" {
+		var err error
+		controllerConfig, err = config.LoadControllerConfig(configFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load controller config", "path", configFile)
+			os.Exit(1)
+		}
+	}
+	if v := os.Getenv("CLOUDFLARE_ZONE_ID"); v != "" {
+		controllerConfig.ZoneID = v
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "auth-mode":
+			controllerConfig.Credentials.AuthMode = authMode
+		case "api-token-file":
+			controllerConfig.Credentials.APITokenFile = apiTokenFile
+		case "zone-id-file":
+			controllerConfig.Credentials.ZoneIDFile = zoneIDFile
+		case "allow-secret-refs":
+			controllerConfig.Credentials.AllowSecretRefs = allowSecretRefs
+		case "target-name":
+			controllerConfig.Target.Name = targetName
+		case "target-namespace":
+			controllerConfig.Target.Namespace = targetNamespace
+		case "target-key":
+			controllerConfig.Target.Key = targetKey
+		case "target-label-selector":
+			controllerConfig.Target.LabelSelector = targetLabelSelector
+		case "zone-id":
+			controllerConfig.ZoneID = zoneID
+		case "requeue-interval":
+			controllerConfig.RequeueInterval = requeueInterval
+		case "resync-jitter":
+			controllerConfig.ResyncJitter = resyncJitter
+		case "max-concurrent-reconciles":
+			controllerConfig.Queue.MaxConcurrentReconciles = maxConcurrentReconciles
+		case "requeue-base-delay":
+			controllerConfig.Queue.BaseDelay = requeueBaseDelay
+		case "requeue-max-delay":
+			controllerConfig.Queue.MaxDelay = requeueMaxDelay
+		case "requeue-qps":
+			controllerConfig.Queue.QPS = requeueQPS
+		case "requeue-burst":
+			controllerConfig.Queue.Burst = requeueBurst
+		case "cloudflare-qps":
+			controllerConfig.APIRateLimit.QPS = cloudflareQPS
+		case "cloudflare-burst":
+			controllerConfig.APIRateLimit.Burst = cloudflareBurst
+		case "cloudflare-base-url":
+			controllerConfig.API.BaseURL = cloudflareBaseURL
+		case "cloudflare-proxy-url":
+			controllerConfig.API.ProxyURL = cloudflareProxyURL
+		case "cloudflare-ca-file":
+			controllerConfig.API.CAFile = cloudflareCAFile
+		case "cloudflare-request-timeout":
+			controllerConfig.API.RequestTimeout = cloudflareRequestTimeout
+		case "user-agent-suffix":
+			controllerConfig.API.UserAgentSuffix = userAgentSuffix
+		case "tracing-endpoint":
+			controllerConfig.Tracing.Endpoint = tracingEndpoint
+		case "tracing-insecure":
+			controllerConfig.Tracing.Insecure = tracingInsecure
+		case "tracing-sample-ratio":
+			controllerConfig.Tracing.SampleRatio = tracingSampleRatio
+		case "audit-file":
+			controllerConfig.Audit.File = auditFile
+		case "history-configmap":
+			controllerConfig.History.ConfigMapName = historyConfigMap
+		case "history-limit":
+			controllerConfig.History.Limit = historyLimit
+		case "record-cache-ttl":
+			controllerConfig.RecordCacheTTL = recordCacheTTL
+		case "access-check-interval":
+			controllerConfig.AccessCheckInterval = accessCheckInterval
+		case "batch-changes":
+			controllerConfig.Batch.Enabled = batchChanges
+		case "batch-size":
+			controllerConfig.Batch.Size = batchSize
+		case "apply-concurrency":
+			controllerConfig.ApplyConcurrency = applyConcurrency
+		case "deletion-grace-period":
+			controllerConfig.DeletionGracePeriod = deletionGracePeriod
+		case "require-approval":
+			controllerConfig.Approval.Required = requireApproval
+		case "auto-approve-creates":
+			controllerConfig.Approval.AutoApproveCreates = autoApproveCreates
+		case "default-proxied":
+			controllerConfig.Records.Proxied = &defaultProxied
+		case "default-ttl":
+			controllerConfig.Records.TTL = defaultTTL
+		case "comment-prefix":
+			controllerConfig.Records.CommentPrefix = commentPrefix
+		}
+	})
+	if err := controllerConfig.Validate(); err != nil {
+		setupLog.Error(err, "invalid controller config")
+		os.Exit(1)
+	}
+
+	tracingConfig := tracing.Config{
+		Endpoint:    controllerConfig.Tracing.Endpoint,
+		Insecure:    controllerConfig.Tracing.Insecure,
+		SampleRatio: controllerConfig.Tracing.SampleRatio,
+	}
+	shutdownTracing := func(context.Context) error { return nil }
+	if tracingConfig.Enabled() {
+		var err error
+		shutdownTracing, err = tracing.Setup(context.Background(), tracingConfig)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		setupLog.Info("Exporting traces over OTLP", "endpoint", tracingConfig.Endpoint)
+	}
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -161,8 +393,15 @@ func main() {
 		metricsServerOptions.KeyName = metricsCertKey
 	}
 
+	cacheOpts, err := controller.CacheOptions(controllerConfig.Target)
+	if err != nil {
+		setupLog.Error(err, "invalid target")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
+		Cache:                  cacheOpts,
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
@@ -185,26 +424,136 @@ func main() {
 		os.Exit(1)
 	}
 
-	cfAPIToken := os.Getenv("CLOUDFLARE_API_TOKEN")
-	cfZoneID := os.Getenv("CLOUDFLARE_ZONE_ID")
-	if cfAPIToken == "" || cfZoneID == "" {
-		setupLog.Error(
-			fmt.Errorf("CLOUDFLARE_API_TOKEN and CLOUDFLARE_ZONE_ID must be set"),
-			"missing required environment variables",
-		)
+	credentialSource := credentials.Source{
+		AuthMode:     controllerConfig.Credentials.AuthMode,
+		APITokenFile: controllerConfig.Credentials.APITokenFile,
+		ZoneIDFile:   controllerConfig.Credentials.ZoneIDFile,
+		APIToken:     os.Getenv("CLOUDFLARE_API_TOKEN"),
+		APIKey:       os.Getenv("CLOUDFLARE_API_KEY"),
+		APIEmail:     os.Getenv("CLOUDFLARE_EMAIL"),
+		ZoneID:       controllerConfig.ZoneID,
+	}
+	creds, err := credentialSource.Load()
+	if err != nil {
+		setupLog.Error(err, "unable to load Cloudflare credentials, set CLOUDFLARE_API_TOKEN or --api-token-file, "+
+			"or CLOUDFLARE_API_KEY and CLOUDFLARE_EMAIL with --auth-mode=apiKey", "authMode", credentialSource.AuthMode)
 		os.Exit(1)
 	}
+	if creds.APIKey != "" {
+		setupLog.Info("WARNING: authenticating with a Global API Key, which has full access to every zone of the "+
+			"account. Prefer an API token scoped to Zone DNS Edit on this zone.", "email", creds.APIEmail)
+	}
 
-	cfClient := cloudflare.NewClient(cfAPIToken, cfZoneID)
+	httpClient, err := cloudflare.NewHTTPClient(cloudflare.TransportConfig{
+		ProxyURL: controllerConfig.API.ProxyURL,
+		CAFile:   controllerConfig.API.CAFile,
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to configure the Cloudflare HTTP client")
+		os.Exit(1)
+	}
+	apiOptions := []cloudflare.Option{cloudflare.WithHTTPClient(httpClient)}
+	if controllerConfig.API.BaseURL != "" {
+		setupLog.Info("Using a custom Cloudflare API base URL", "baseURL", controllerConfig.API.BaseURL)
+		apiOptions = append(apiOptions, cloudflare.WithBaseURL(controllerConfig.API.BaseURL))
+	}
+	if controllerConfig.API.RequestTimeout > 0 {
+		apiOptions = append(apiOptions, cloudflare.WithRequestTimeout(controllerConfig.API.RequestTimeout))
+	}
+	if controllerConfig.API.UserAgentSuffix != "" {
+		apiOptions = append(apiOptions, cloudflare.WithUserAgentSuffix(controllerConfig.API.UserAgentSuffix))
+	}
+
+	// The limiter outlives clients replaced on credential rotation.
+	limiter := cloudflare.NewLimiter(controllerConfig.APIRateLimit.QPS, controllerConfig.APIRateLimit.Burst)
+	newCloudflareClient := func(creds credentials.Credentials, limiter *rate.Limiter) cloudflare.Client {
+		opts := append(creds.Options(), apiOptions...)
+		c := cloudflare.NewClient(creds.APIToken, creds.ZoneID, append(opts,
+			cloudflare.WithLimiter(limiter),
+			cloudflare.WithBatchSize(controllerConfig.Batch.Size),
+		)...)
+		if controllerConfig.RecordCacheTTL > 0 {
+			c = cloudflare.NewCachedClient(c, controllerConfig.RecordCacheTTL)
+		}
+		return c
+	}
+	cfClient := cloudflare.NewReloadableClient(newCloudflareClient(creds, limiter))
+	if credentialSource.Files() {
+		watcher := credentials.NewWatcher(credentialSource, creds, func(creds credentials.Credentials) {
+			cfClient.Swap(newCloudflareClient(creds, limiter))
+		}, ctrl.Log.WithName("credentials"))
+		if err := mgr.Add(watcher); err != nil {
+			setupLog.Error(err, "unable to watch credential files")
+			os.Exit(1)
+		}
+	}
+	var clientPool *credentials.Pool
+	if controllerConfig.Credentials.AllowSecretRefs {
+		// Other accounts have their own Cloudflare rate limits.
+		clientPool = credentials.NewPool(func(creds credentials.Credentials) cloudflare.Client {
+			return newCloudflareClient(creds,
+				cloudflare.NewLimiter(controllerConfig.APIRateLimit.QPS, controllerConfig.APIRateLimit.Burst))
+		})
+	}
+	auditLogger, err := audit.New(ctrl.Log.WithName("audit"), controllerConfig.Audit.File)
+	if err != nil {
+		setupLog.Error(err, "unable to open audit file")
+		os.Exit(1)
+	}
+	notifier, err := newNotifier(controllerConfig.Notifications)
+	if err != nil {
+		setupLog.Error(err, "unable to set up notifications")
+		os.Exit(1)
+	}
+	if notifier != nil {
+		if err := mgr.Add(notifier); err != nil {
+			setupLog.Error(err, "unable to set up notifications")
+			os.Exit(1)
+		}
+	}
+	var historyStore *history.Store
+	if controllerConfig.History.Limit > 0 {
+		// The manager only caches the target ConfigMap, so the history is read uncached.
+		historyClient, err := client.New(mgr.GetConfig(), client.Options{Scheme: mgr.GetScheme()})
+		if err != nil {
+			setupLog.Error(err, "unable to create history client")
+			os.Exit(1)
+		}
+		historyStore = history.NewStore(historyClient, types.NamespacedName{
+			Namespace: controllerConfig.Target.Namespace,
+			Name:      controllerConfig.History.ConfigMapName,
+		}, controllerConfig.History.Limit)
+	}
 	reconciler := &controller.CloudflaredDNSReconciler{
-		Client:          mgr.GetClient(),
-		Scheme:          mgr.GetScheme(),
-		Cloudflare:      cfClient,
-		TargetName:      targetName,
-		TargetNamespace: targetNamespace,
-		TargetKey:       targetKey,
-	}
-	if err := reconciler.SetupWithManager(mgr); err != nil {
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		Cloudflare:          cfClient,
+		ZoneID:              creds.ZoneID,
+		Clients:             clientPool,
+		TargetName:          controllerConfig.Target.Name,
+		TargetNamespace:     controllerConfig.Target.Namespace,
+		TargetKey:           controllerConfig.Target.Key,
+		Defaults:            controllerConfig.Records,
+		RequeueInterval:     controllerConfig.RequeueInterval,
+		ResyncJitter:        controllerConfig.ResyncJitter,
+		BatchChanges:        controllerConfig.Batch.Enabled,
+		ApplyConcurrency:    controllerConfig.ApplyConcurrency,
+		DeletionGracePeriod: controllerConfig.DeletionGracePeriod,
+		RequireApproval:     controllerConfig.Approval.Required,
+		AutoApproveCreates:  controllerConfig.Approval.AutoApproveCreates,
+		Audit:               auditLogger,
+		Notifier:            notifier,
+		History:             historyStore,
+	}
+	if err := reconciler.SetupWithManager(mgr, controller.SetupOptions{
+		MaxConcurrentReconciles: controllerConfig.Queue.MaxConcurrentReconciles,
+		RateLimiter: controller.RateLimiterOptions{
+			BaseDelay: controllerConfig.Queue.BaseDelay,
+			MaxDelay:  controllerConfig.Queue.MaxDelay,
+			QPS:       controllerConfig.Queue.QPS,
+			Burst:     controllerConfig.Queue.Burst,
+		},
+	}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CloudflaredDNSReconciler")
 		os.Exit(1)
 	}
@@ -219,10 +568,60 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if controllerConfig.AccessCheckInterval > 0 {
+		checker := health.NewCloudflareChecker(cfClient, controllerConfig.AccessCheckInterval,
+			ctrl.Log.WithName("cloudflare-access"))
+		if err := mgr.Add(checker); err != nil {
+			setupLog.Error(err, "unable to set up Cloudflare access check")
+			os.Exit(1)
+		}
+		if err := mgr.AddReadyzCheck("cloudflare", checker.Check); err != nil {
+			setupLog.Error(err, "unable to set up Cloudflare ready check")
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctrl.SetupSignalHandler())
+	// Flush the spans of the last reconciles.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if flushErr := shutdownTracing(shutdownCtx); flushErr != nil {
+		setupLog.Error(flushErr, "unable to flush traces")
+	}
+	if closeErr := auditLogger.Close(); closeErr != nil {
+		setupLog.Error(closeErr, "unable to close audit file")
+	}
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// newNotifier returns a notifier posting to the configured webhooks, or nil if
+// there are none.
+func newNotifier(cfg config.Notifications) (*notify.Notifier, error) {
+	if len(cfg.Webhooks) == 0 {
+		return nil, nil
+	}
+	webhooks := make([]notify.Webhook, 0, len(cfg.Webhooks))
+	for i, hookCfg := range cfg.Webhooks {
+		url := hookCfg.URL
+		if hookCfg.URLFile != "" {
+			data, err := os.ReadFile(hookCfg.URLFile)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %d: %w", i, err)
+			}
+			url = strings.TrimSpace(string(data))
+		}
+		hook, err := notify.NewWebhook(url, hookCfg.Format, hookCfg.Template, nil)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %d: %w", i, err)
+		}
+		webhooks = append(webhooks, hook)
+	}
+	return notify.New(webhooks, notify.Options{
+		FailureThreshold: cfg.FailureThreshold,
+		DedupWindow:      cfg.DedupWindow,
+	}, ctrl.Log.WithName("notify")), nil
+}
@@ -0,0 +1,121 @@
+// Package audit records every DNS change the controller makes, for a
+// compliance trail kept apart from the debug logs.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Actions and results of an Event.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	// ActionAdopt is a create that found the record already in place.
+	ActionAdopt = "adopt"
+
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Record is the state of a DNS record before or after a change.
+type Record struct {
+	ID      string   `json:"id,omitempty"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Content string   `json:"content"`
+	Proxied bool     `json:"proxied"`
+	TTL     int      `json:"ttl"`
+	Comment string   `json:"comment,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// Event is one DNS record change. Before is unset for creates and After for
+// deletes.
+type Event struct {
+	Time            time.Time `json:"time"`
+	Action          string    `json:"action"`
+	Result          string    `json:"result"`
+	Error           string    `json:"error,omitempty"`
+	Source          string    `json:"source"`
+	ResourceVersion string    `json:"resourceVersion"`
+	ZoneID          string    `json:"zoneID"`
+	Tunnel          string    `json:"tunnel,omitempty"`
+	Hostname        string    `json:"hostname"`
+	Before          *Record   `json:"before,omitempty"`
+	After           *Record   `json:"after,omitempty"`
+}
+
+// Logger writes Events to a dedicated logger and, when a path is set, appends
+// them as JSON lines to a file. A nil Logger discards events.
+type Logger struct {
+	log logr.Logger
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// New returns a Logger writing to log and, if path is not empty, to path.
+func New(log logr.Logger, path string) (*Logger, error) {
+	l := &Logger{log: log}
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit file: %w", err)
+		}
+		l.file = f
+	}
+	return l, nil
+}
+
+// Record writes ev, setting its time if unset. Failing to write the file is
+// logged rather than returned, so auditing never blocks a DNS change.
+func (l *Logger) Record(ev Event) {
+	if l == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	l.log.Info("DNS record change",
+		"action", ev.Action,
+		"result", ev.Result,
+		"hostname", ev.Hostname,
+		"source", ev.Source,
+		"resourceVersion", ev.ResourceVersion,
+		"zoneID", ev.ZoneID,
+		"tunnel", ev.Tunnel,
+		"before", ev.Before,
+		"after", ev.After,
+		"error", ev.Error,
+	)
+	if l.file == nil {
+		return
+	}
+	line, err := json.Marshal(ev)
+	if err != nil {
+		l.log.Error(err, "unable to encode audit event")
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		l.log.Error(err, "unable to write audit event", "path", l.file.Name())
+	}
+}
+
+// Close closes the audit file.
+func (l *Logger) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
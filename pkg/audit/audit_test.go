@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestLoggerAppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for range 2 {
+		// Reopening appends instead of truncating.
+		l, err := New(logr.Discard(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Record(Event{
+			Action:   ActionDelete,
+			Result:   ResultSuccess,
+			Source:   "cloudflared/cloudflared",
+			Hostname: "app.example.com",
+			Before:   &Record{ID: "rec-1", Name: "app.example.com", Type: "CNAME"},
+		})
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d audit events, want 2", len(events))
+	}
+	if ev := events[0]; ev.Time.IsZero() || ev.Before == nil || ev.Before.ID != "rec-1" || ev.After != nil {
+		t.Errorf("unexpected audit event %+v", ev)
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	l.Record(Event{Action: ActionCreate})
+	if err := l.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,142 @@
+package cloudflare
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go/v6"
+	"github.com/cloudflare/cloudflare-go/v6/dns"
+)
+
+// defaultBatchSize keeps each batch within the limit of Cloudflare's free plans.
+const defaultBatchSize = 200
+
+// BatchResult is the outcome of one batch request of a plan.
+type BatchResult struct {
+	Plan    Plan        // the changes sent in the request
+	Created []DNSRecord // the records the request created
+	Err     error       // why the request failed, nil when it was applied
+}
+
+// Plan is a set of record changes for one zone.
+type Plan struct {
+	Creates []DNSRecord
+	Updates []DNSRecord
+	Deletes []DNSRecord
+}
+
+func (p Plan) Len() int {
+	return len(p.Creates) + len(p.Updates) + len(p.Deletes)
+}
+
+func (p Plan) IsEmpty() bool {
+	return p.Len() == 0
+}
+
+// chunks splits p into plans of at most size changes. A hostname's changes
+// always land in the same chunk, so a record is never deleted in one batch and
+// replaced in another that may fail.
+func (p Plan) chunks(size int) []Plan {
+	if size <= 0 || p.Len() <= size {
+		return []Plan{p}
+	}
+	var names []string
+	groups := map[string]*Plan{}
+	group := func(name string) *Plan {
+		g, ok := groups[name]
+		if !ok {
+			g = &Plan{}
+			groups[name] = g
+			names = append(names, name)
+		}
+		return g
+	}
+	for _, rec := range p.Deletes {
+		g := group(rec.Name)
+		g.Deletes = append(g.Deletes, rec)
+	}
+	for _, rec := range p.Updates {
+		g := group(rec.Name)
+		g.Updates = append(g.Updates, rec)
+	}
+	for _, rec := range p.Creates {
+		g := group(rec.Name)
+		g.Creates = append(g.Creates, rec)
+	}
+
+	var result []Plan
+	var current Plan
+	for _, name := range names {
+		g := groups[name]
+		if !current.IsEmpty() && current.Len()+g.Len() > size {
+			result = append(result, current)
+			current = Plan{}
+		}
+		current.Deletes = append(current.Deletes, g.Deletes...)
+		current.Updates = append(current.Updates, g.Updates...)
+		current.Creates = append(current.Creates, g.Creates...)
+	}
+	if !current.IsEmpty() {
+		result = append(result, current)
+	}
+	return result
+}
+
+// WithBatchSize sets the maximum number of changes sent in one batch request.
+func WithBatchSize(size int) Option {
+	return func(c *client) {
+		c.batchSize = size
+	}
+}
+
+// ApplyPlan submits plan through the zone's DNS batch endpoint and returns the
+// result of every request it sent. Each batch is applied atomically by
+// Cloudflare; plans larger than the batch size are split by hostname and sent
+// until one fails, so an error may leave earlier batches applied but never
+// half of one hostname's changes.
+func (c *client) ApplyPlan(ctx context.Context, plan Plan) ([]BatchResult, error) {
+	var results []BatchResult
+	for _, chunk := range plan.chunks(c.batchSize) {
+		params := dns.RecordBatchParams{ZoneID: cloudflare.F(c.zoneID)}
+		if len(chunk.Deletes) > 0 {
+			deletes := make([]dns.RecordBatchParamsDelete, 0, len(chunk.Deletes))
+			for _, rec := range chunk.Deletes {
+				deletes = append(deletes, dns.RecordBatchParamsDelete{ID: cloudflare.F(rec.ID)})
+			}
+			params.Deletes = cloudflare.F(deletes)
+		}
+		if len(chunk.Updates) > 0 {
+			patches := make([]dns.BatchPatchUnionParam, 0, len(chunk.Updates))
+			for _, rec := range chunk.Updates {
+				patches = append(patches, dns.BatchPatchCNAMERecordParam{
+					ID:               cloudflare.F(rec.ID),
+					CNAMERecordParam: cnameParam(rec),
+				})
+			}
+			params.Patches = cloudflare.F(patches)
+		}
+		if len(chunk.Creates) > 0 {
+			posts := make([]dns.RecordBatchParamsPostUnion, 0, len(chunk.Creates))
+			for _, rec := range chunk.Creates {
+				posts = append(posts, cnameParam(rec))
+			}
+			params.Posts = cloudflare.F(posts)
+		}
+
+		var res *dns.RecordBatchResponse
+		err := c.do(ctx, "batch", func() (err error) {
+			res, err = c.cf.DNS.Records.Batch(ctx, params)
+			return err
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to apply DNS record batch of %d changes: %w", chunk.Len(), err)
+			return append(results, BatchResult{Plan: chunk, Err: err}), err
+		}
+		result := BatchResult{Plan: chunk}
+		for _, r := range res.Posts {
+			result.Created = append(result.Created, fromResponse(r))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
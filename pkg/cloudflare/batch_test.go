@@ -0,0 +1,48 @@
+package cloudflare
+
+import (
+	"fmt"
+	"testing"
+)
+
+func records(prefix string, n int) []DNSRecord {
+	recs := make([]DNSRecord, n)
+	for i := range recs {
+		recs[i] = DNSRecord{ID: fmt.Sprintf("%s-%d", prefix, i), Name: fmt.Sprintf("%s-%d.example.com", prefix, i)}
+	}
+	return recs
+}
+
+func TestPlanChunks(t *testing.T) {
+	plan := Plan{Creates: records("create", 3), Updates: records("update", 2), Deletes: records("delete", 4)}
+
+	chunks := plan.chunks(4)
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(chunks))
+	}
+	want := []struct{ creates, updates, deletes int }{{0, 0, 4}, {2, 2, 0}, {1, 0, 0}}
+	for i, chunk := range chunks {
+		got := struct{ creates, updates, deletes int }{len(chunk.Creates), len(chunk.Updates), len(chunk.Deletes)}
+		if got != want[i] {
+			t.Errorf("chunk %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	moved := Plan{
+		Creates: []DNSRecord{{Name: "a.example.com"}, {Name: "b.example.com"}},
+		Deletes: []DNSRecord{{ID: "old-a", Name: "a.example.com"}, {ID: "old-b", Name: "b.example.com"}},
+	}
+	chunks = moved.chunks(3)
+	if len(chunks) != 2 {
+		t.Fatalf("got %d chunks for moved records, want 2", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if len(chunk.Creates) != 1 || len(chunk.Deletes) != 1 || chunk.Creates[0].Name != chunk.Deletes[0].Name {
+			t.Errorf("chunk %d splits a hostname's changes: %+v", i, chunk)
+		}
+	}
+
+	if got := plan.chunks(0); len(got) != 1 || got[0].Len() != plan.Len() {
+		t.Errorf("chunks(0) should not split the plan, got %d chunks", len(got))
+	}
+}
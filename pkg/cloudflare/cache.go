@@ -0,0 +1,178 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// sharedListTimeout bounds a listing shared by concurrent callers, which runs
+// detached from any one caller's context.
+const sharedListTimeout = 2 * time.Minute
+
+// Refresher is implemented by clients that cache records. RefreshDNSRecords
+// bypasses the cache and lists the zone from the API.
+type Refresher interface {
+	RefreshDNSRecords(ctx context.Context) ([]DNSRecord, error)
+}
+
+// cachedClient keeps a snapshot of the zone's records so that concurrent and
+// repeated reconciles share one listing. A Client is bound to a single zone, so
+// this is that zone's snapshot. The snapshot is patched after every successful
+// create, update and delete made through this client.
+type cachedClient struct {
+	Client
+	ttl   time.Duration
+	group singleflight.Group
+
+	mu        sync.Mutex
+	records   []DNSRecord
+	fetchedAt time.Time
+	valid     bool
+	// generation is bumped on every mutation so a listing that raced with
+	// a mutation is not stored as the snapshot.
+	generation uint64
+}
+
+// NewCachedClient wraps next with a record snapshot that expires after ttl.
+func NewCachedClient(next Client, ttl time.Duration) Client {
+	return &cachedClient{Client: next, ttl: ttl}
+}
+
+func (c *cachedClient) ListDNSRecords(ctx context.Context) ([]DNSRecord, error) {
+	c.mu.Lock()
+	if c.valid && time.Since(c.fetchedAt) < c.ttl {
+		records := slices.Clone(c.records)
+		c.mu.Unlock()
+		return records, nil
+	}
+	c.mu.Unlock()
+	return c.RefreshDNSRecords(ctx)
+}
+
+// RefreshDNSRecords lists the zone once for all concurrent callers. The shared
+// listing does not stop when the caller that started it gives up, so the
+// others still get its result; each caller only waits as long as its own ctx.
+func (c *cachedClient) RefreshDNSRecords(ctx context.Context) ([]DNSRecord, error) {
+	ch := c.group.DoChan("list", func() (interface{}, error) {
+		c.mu.Lock()
+		generation := c.generation
+		c.mu.Unlock()
+
+		listCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedListTimeout)
+		defer cancel()
+		records, err := c.Client.ListDNSRecords(listCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if generation == c.generation {
+			c.records = slices.Clone(records)
+			c.fetchedAt = time.Now()
+			c.valid = true
+		} else {
+			c.valid = false
+		}
+		return records, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return slices.Clone(res.Val.([]DNSRecord)), nil
+	}
+}
+
+func (c *cachedClient) CreateDNSRecord(ctx context.Context, record DNSRecord) (DNSRecord, error) {
+	created, err := c.Client.CreateDNSRecord(ctx, record)
+	c.mutate(func() {
+		if err == nil {
+			c.records = append(c.records, created)
+		} else if errors.Is(err, ErrAlreadyExists) {
+			// The snapshot is missing a record someone else created.
+			c.valid = false
+		}
+	})
+	return created, err
+}
+
+func (c *cachedClient) UpdateDNSRecord(ctx context.Context, record DNSRecord) error {
+	err := c.Client.UpdateDNSRecord(ctx, record)
+	c.mutate(func() {
+		if err != nil {
+			return
+		}
+		for i, rec := range c.records {
+			if rec.ID == record.ID {
+				c.records[i] = record
+			}
+		}
+	})
+	return err
+}
+
+func (c *cachedClient) DeleteDNSRecord(ctx context.Context, recordID string) error {
+	err := c.Client.DeleteDNSRecord(ctx, recordID)
+	c.mutate(func() {
+		if err == nil || errors.Is(err, ErrNotFound) {
+			c.records = slices.DeleteFunc(c.records, func(rec DNSRecord) bool {
+				return rec.ID == recordID
+			})
+		}
+	})
+	return err
+}
+
+func (c *cachedClient) ApplyPlan(ctx context.Context, plan Plan) ([]BatchResult, error) {
+	results, err := c.Client.ApplyPlan(ctx, plan)
+	c.mutate(func() {
+		if err != nil {
+			// Some batches may have been applied.
+			c.valid = false
+			return
+		}
+		deleted := make(map[string]struct{}, len(plan.Deletes))
+		for _, rec := range plan.Deletes {
+			deleted[rec.ID] = struct{}{}
+		}
+		c.records = slices.DeleteFunc(c.records, func(rec DNSRecord) bool {
+			_, found := deleted[rec.ID]
+			return found
+		})
+		for _, update := range plan.Updates {
+			for i, rec := range c.records {
+				if rec.ID == update.ID {
+					c.records[i] = update
+				}
+			}
+		}
+		for _, result := range results {
+			c.records = append(c.records, result.Created...)
+		}
+	})
+	return results, err
+}
+
+func (c *cachedClient) ZoneID(ctx context.Context) string {
+	if z, ok := c.Client.(Zoner); ok {
+		return z.ZoneID(ctx)
+	}
+	return ""
+}
+
+// mutate applies fn to the snapshot under the lock and bumps the generation.
+func (c *cachedClient) mutate(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	fn()
+}
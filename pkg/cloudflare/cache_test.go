@@ -0,0 +1,172 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingClient is a Client that counts listings and can block them.
+type countingClient struct {
+	records []DNSRecord
+	lists   atomic.Int32
+	release chan struct{}
+}
+
+func (c *countingClient) ListDNSRecords(ctx context.Context) ([]DNSRecord, error) {
+	c.lists.Add(1)
+	if c.release != nil {
+		select {
+		case <-c.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return c.records, nil
+}
+
+func (c *countingClient) CreateDNSRecord(_ context.Context, record DNSRecord) (DNSRecord, error) {
+	record.ID = "created"
+	return record, nil
+}
+
+func (c *countingClient) UpdateDNSRecord(_ context.Context, _ DNSRecord) error {
+	return nil
+}
+
+func (c *countingClient) DeleteDNSRecord(_ context.Context, _ string) error {
+	return nil
+}
+
+func (c *countingClient) ApplyPlan(_ context.Context, plan Plan) ([]BatchResult, error) {
+	result := BatchResult{Plan: plan}
+	for _, rec := range plan.Creates {
+		rec.ID = "created"
+		result.Created = append(result.Created, rec)
+	}
+	return []BatchResult{result}, nil
+}
+
+func (c *countingClient) IsTunnelRecord(rec DNSRecord, tunnelID string) bool {
+	return rec.Content == tunnelID+".cfargotunnel.com"
+}
+
+func TestCachedClientReusesSnapshot(t *testing.T) {
+	ctx := context.Background()
+	next := &countingClient{records: []DNSRecord{{ID: "rec-1", Name: "app.example.com"}}}
+	c := NewCachedClient(next, time.Minute)
+
+	for range 3 {
+		records, err := c.ListDNSRecords(ctx)
+		if err != nil || len(records) != 1 {
+			t.Fatalf("ListDNSRecords() = %v, %v", records, err)
+		}
+	}
+	if got := next.lists.Load(); got != 1 {
+		t.Errorf("listed %d times, want 1", got)
+	}
+
+	if _, err := c.(Refresher).RefreshDNSRecords(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := next.lists.Load(); got != 2 {
+		t.Errorf("listed %d times after refresh, want 2", got)
+	}
+}
+
+func TestCachedClientDeduplicatesConcurrentLists(t *testing.T) {
+	next := &countingClient{release: make(chan struct{})}
+	c := NewCachedClient(next, time.Minute)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			if _, err := c.ListDNSRecords(context.Background()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(next.release)
+	wg.Wait()
+
+	if got := next.lists.Load(); got != 1 {
+		t.Errorf("listed %d times, want 1", got)
+	}
+}
+
+func TestCachedClientSharedListOutlivesCanceledCaller(t *testing.T) {
+	next := &countingClient{records: []DNSRecord{{ID: "1"}}, release: make(chan struct{})}
+	c := NewCachedClient(next, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.ListDNSRecords(ctx)
+		first <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	second := make(chan error, 1)
+	var records []DNSRecord
+	go func() {
+		var err error
+		records, err = c.ListDNSRecords(context.Background())
+		second <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled caller got %v, want context.Canceled", err)
+	}
+	close(next.release)
+	if err := <-second; err != nil || len(records) != 1 {
+		t.Errorf("other caller got %v, %v, want the shared listing", records, err)
+	}
+	if got := next.lists.Load(); got != 1 {
+		t.Errorf("listed %d times, want 1", got)
+	}
+}
+
+func TestCachedClientPatchesSnapshot(t *testing.T) {
+	ctx := context.Background()
+	next := &countingClient{records: []DNSRecord{
+		{ID: "rec-1", Name: "app.example.com", TTL: 1},
+		{ID: "rec-2", Name: "api.example.com", TTL: 1},
+	}}
+	c := NewCachedClient(next, time.Minute)
+
+	if _, err := c.ListDNSRecords(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateDNSRecord(ctx, DNSRecord{Name: "new.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateDNSRecord(ctx, DNSRecord{ID: "rec-1", Name: "app.example.com", TTL: 300}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteDNSRecord(ctx, "rec-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := c.ListDNSRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.lists.Load() != 1 {
+		t.Errorf("mutations should not invalidate the snapshot")
+	}
+	want := map[string]int{"rec-1": 300, "created": 0}
+	if len(records) != len(want) {
+		t.Fatalf("records = %+v", records)
+	}
+	for _, rec := range records {
+		if ttl, ok := want[rec.ID]; !ok || ttl != rec.TTL {
+			t.Errorf("unexpected record %+v", rec)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cfemulator
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// AdminPath is the path prefix AdminHandler is meant to be mounted at. It
+// does not clash with any Cloudflare API path.
+const AdminPath = "/__emulator/"
+
+// faultSpec is the JSON form of a Fault, with durations such as "5s".
+type faultSpec struct {
+	Method     string `json:"method,omitempty"`
+	PathPrefix string `json:"pathPrefix,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	RetryAfter string `json:"retryAfter,omitempty"`
+	Latency    string `json:"latency,omitempty"`
+	Times      int    `json:"times,omitempty"`
+}
+
+// Faults returns the faults that are still active.
+func (e *Emulator) Faults() []Fault {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	faults := make([]Fault, 0, len(e.faults))
+	for _, f := range e.faults {
+		faults = append(faults, *f)
+	}
+	return faults
+}
+
+// AdminHandler exposes Inject, ClearFaults, Faults and Requests over HTTP, for
+// tests that run the emulator out of process:
+//
+//	POST   /__emulator/faults    injects the fault in the body, e.g. {"status": 429, "times": 2}
+//	GET    /__emulator/faults    lists the active faults
+//	DELETE /__emulator/faults    clears every fault
+//	GET    /__emulator/requests  lists the requests received so far
+//
+// It is not subject to injected faults or credentials.
+func (e *Emulator) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+AdminPath+"faults", e.injectFault)
+	mux.HandleFunc("GET "+AdminPath+"faults", func(w http.ResponseWriter, _ *http.Request) {
+		specs := []faultSpec{}
+		for _, f := range e.Faults() {
+			specs = append(specs, toSpec(f))
+		}
+		writeResult(w, http.StatusOK, specs)
+	})
+	mux.HandleFunc("DELETE "+AdminPath+"faults", func(w http.ResponseWriter, _ *http.Request) {
+		e.ClearFaults()
+		writeResult(w, http.StatusOK, []faultSpec{})
+	})
+	mux.HandleFunc("GET "+AdminPath+"requests", func(w http.ResponseWriter, _ *http.Request) {
+		writeResult(w, http.StatusOK, e.Requests())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, codeRouteNotFound, "No route for that URI")
+	})
+	return mux
+}
+
+func (e *Emulator) injectFault(w http.ResponseWriter, r *http.Request) {
+	var spec faultSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid fault: "+err.Error())
+		return
+	}
+	f := Fault{Method: spec.Method, PathPrefix: spec.PathPrefix, Status: spec.Status, Times: spec.Times}
+	for _, d := range []struct {
+		value string
+		into  *time.Duration
+	}{{spec.RetryAfter, &f.RetryAfter}, {spec.Latency, &f.Latency}} {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, "Invalid fault: "+err.Error())
+			return
+		}
+		*d.into = parsed
+	}
+	e.Inject(f)
+	writeResult(w, http.StatusOK, toSpec(f))
+}
+
+func toSpec(f Fault) faultSpec {
+	spec := faultSpec{Method: f.Method, PathPrefix: f.PathPrefix, Status: f.Status, Times: f.Times}
+	if f.RetryAfter > 0 {
+		spec.RetryAfter = f.RetryAfter.String()
+	}
+	if f.Latency > 0 {
+		spec.Latency = f.Latency.String()
+	}
+	return spec
+}
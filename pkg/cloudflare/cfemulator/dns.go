@@ -0,0 +1,310 @@
+package cfemulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// recordInput is the body of a record create, edit or batch entry. Fields
+// left out keep their value on edit.
+type recordInput struct {
+	ID      string    `json:"id"`
+	Name    *string   `json:"name"`
+	Type    *string   `json:"type"`
+	Content *string   `json:"content"`
+	Proxied *bool     `json:"proxied"`
+	TTL     *float64  `json:"ttl"`
+	Comment *string   `json:"comment"`
+	Tags    *[]string `json:"tags"`
+}
+
+type batchInput struct {
+	Deletes []recordInput `json:"deletes"`
+	Patches []recordInput `json:"patches"`
+	Puts    []recordInput `json:"puts"`
+	Posts   []recordInput `json:"posts"`
+}
+
+// recordError is a failed record change, written as a Cloudflare error.
+type recordError struct {
+	status  int
+	code    int
+	message string
+}
+
+func (e *recordError) Error() string {
+	return e.message
+}
+
+func (e *Emulator) listRecords(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	z, ok := e.zones[r.PathValue("zone_id")]
+	var records []Record
+	if ok {
+		query := r.URL.Query()
+		name := query.Get("name")
+		if name == "" {
+			name = query.Get("name.exact")
+		}
+		for _, rec := range z.sorted() {
+			if (name == "" || strings.EqualFold(rec.Name, name)) && (query.Get("type") == "" || rec.Type == query.Get("type")) {
+				records = append(records, rec)
+			}
+		}
+	}
+	pageCap := e.pageCap
+	e.mu.Unlock()
+	if !ok {
+		writeZoneNotFound(w, r)
+		return
+	}
+	writePage(w, r, records, pageCap)
+}
+
+func (e *Emulator) getRecord(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	z, ok := e.zones[r.PathValue("zone_id")]
+	var rec Record
+	var found bool
+	if ok {
+		rec, found = z.records[r.PathValue("id")]
+	}
+	e.mu.Unlock()
+	switch {
+	case !ok:
+		writeZoneNotFound(w, r)
+	case !found:
+		writeError(w, http.StatusNotFound, codeRecordNotFound, "Record does not exist.")
+	default:
+		writeResult(w, http.StatusOK, rec)
+	}
+}
+
+func (e *Emulator) createRecord(w http.ResponseWriter, r *http.Request) {
+	var in recordInput
+	e.change(w, r, &in, func(z *zone) (any, error) {
+		return e.create(z, in)
+	})
+}
+
+func (e *Emulator) editRecord(w http.ResponseWriter, r *http.Request) {
+	var in recordInput
+	e.change(w, r, &in, func(z *zone) (any, error) {
+		in.ID = r.PathValue("id")
+		return e.edit(z, in, false)
+	})
+}
+
+func (e *Emulator) updateRecord(w http.ResponseWriter, r *http.Request) {
+	var in recordInput
+	e.change(w, r, &in, func(z *zone) (any, error) {
+		in.ID = r.PathValue("id")
+		return e.edit(z, in, true)
+	})
+}
+
+func (e *Emulator) deleteRecord(w http.ResponseWriter, r *http.Request) {
+	e.change(w, r, nil, func(z *zone) (any, error) {
+		return e.delete(z, r.PathValue("id"))
+	})
+}
+
+// batchRecords applies deletes, patches, puts and posts in that order. Like
+// the real endpoint, the batch is all or nothing.
+func (e *Emulator) batchRecords(w http.ResponseWriter, r *http.Request) {
+	var in batchInput
+	e.change(w, r, &in, func(z *zone) (any, error) {
+		staged := &zone{Zone: z.Zone, records: make(map[string]Record, len(z.records))}
+		for id, rec := range z.records {
+			staged.records[id] = rec
+		}
+		result := map[string][]Record{"deletes": {}, "patches": {}, "puts": {}, "posts": {}}
+		for _, d := range in.Deletes {
+			rec, err := e.delete(staged, d.ID)
+			if err != nil {
+				return nil, err
+			}
+			result["deletes"] = append(result["deletes"], rec)
+		}
+		for _, p := range in.Patches {
+			rec, err := e.edit(staged, p, false)
+			if err != nil {
+				return nil, err
+			}
+			result["patches"] = append(result["patches"], rec)
+		}
+		for _, p := range in.Puts {
+			rec, err := e.edit(staged, p, true)
+			if err != nil {
+				return nil, err
+			}
+			result["puts"] = append(result["puts"], rec)
+		}
+		for _, p := range in.Posts {
+			rec, err := e.create(staged, p)
+			if err != nil {
+				return nil, err
+			}
+			result["posts"] = append(result["posts"], rec)
+		}
+		z.records = staged.records
+		return result, nil
+	})
+}
+
+// change decodes the body into in, when set, and runs apply on the zone of
+// the request while holding e.mu.
+func (e *Emulator) change(w http.ResponseWriter, r *http.Request, in any, apply func(*zone) (any, error)) {
+	if in != nil {
+		if err := json.NewDecoder(r.Body).Decode(in); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+	}
+	e.mu.Lock()
+	z, ok := e.zones[r.PathValue("zone_id")]
+	var result any
+	var err error
+	if ok {
+		result, err = apply(z)
+	}
+	e.mu.Unlock()
+
+	var recErr *recordError
+	switch {
+	case !ok:
+		writeZoneNotFound(w, r)
+	case errors.As(err, &recErr):
+		writeError(w, recErr.status, recErr.code, recErr.message)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+	default:
+		writeResult(w, http.StatusOK, result)
+	}
+}
+
+func (e *Emulator) create(z *zone, in recordInput) (Record, error) {
+	if in.Name == nil || in.Type == nil || in.Content == nil {
+		return Record{}, &recordError{http.StatusBadRequest, codeInvalidRequest, "name, type and content are required"}
+	}
+	var rec Record
+	applyInput(&rec, in)
+	if err := z.checkConflict(rec); err != nil {
+		return Record{}, err
+	}
+	rec = e.newRecord(z, rec)
+	z.records[rec.ID] = rec
+	return rec, nil
+}
+
+// edit patches the record in.ID, or replaces it when overwrite is set.
+func (e *Emulator) edit(z *zone, in recordInput, overwrite bool) (Record, error) {
+	rec, ok := z.records[in.ID]
+	if !ok {
+		return Record{}, &recordError{http.StatusNotFound, codeRecordNotFound, "Record does not exist."}
+	}
+	if overwrite {
+		rec = Record{ID: rec.ID, ZoneID: rec.ZoneID, ZoneName: rec.ZoneName, CreatedOn: rec.CreatedOn}
+	}
+	applyInput(&rec, in)
+	if rec.Name == "" || rec.Type == "" || rec.Content == "" {
+		return Record{}, &recordError{http.StatusBadRequest, codeInvalidRequest, "name, type and content are required"}
+	}
+	if err := z.checkConflict(rec); err != nil {
+		return Record{}, err
+	}
+	rec.ModifiedOn = time.Now().UTC()
+	z.records[rec.ID] = rec
+	return rec, nil
+}
+
+func (e *Emulator) delete(z *zone, id string) (Record, error) {
+	rec, ok := z.records[id]
+	if !ok {
+		return Record{}, &recordError{http.StatusNotFound, codeRecordNotFound, "Record does not exist."}
+	}
+	delete(z.records, id)
+	return Record{ID: rec.ID}, nil
+}
+
+// newRecord fills in the generated fields of rec. e.mu must be held.
+func (e *Emulator) newRecord(z *zone, rec Record) Record {
+	if rec.ID == "" {
+		e.nextID++
+		rec.ID = fmt.Sprintf("%032x", e.nextID)
+	}
+	now := time.Now().UTC()
+	rec.ZoneID, rec.ZoneName = z.ID, z.Name
+	rec.Proxiable = true
+	if rec.TTL == 0 {
+		rec.TTL = 1
+	}
+	if rec.Tags == nil {
+		rec.Tags = []string{}
+	}
+	rec.CreatedOn, rec.ModifiedOn = now, now
+	return rec
+}
+
+func applyInput(rec *Record, in recordInput) {
+	if in.Name != nil {
+		rec.Name = strings.ToLower(strings.TrimSuffix(*in.Name, "."))
+	}
+	if in.Type != nil {
+		rec.Type = *in.Type
+	}
+	if in.Content != nil {
+		rec.Content = *in.Content
+	}
+	if in.Proxied != nil {
+		rec.Proxied = *in.Proxied
+	}
+	if in.TTL != nil {
+		rec.TTL = int(*in.TTL)
+	}
+	if in.Comment != nil {
+		rec.Comment = *in.Comment
+	}
+	if in.Tags != nil {
+		rec.Tags = append([]string{}, *in.Tags...)
+	}
+}
+
+// checkConflict rejects a CNAME sharing its name with another record, and
+// any record identical to an existing one.
+func (z *zone) checkConflict(rec Record) error {
+	for _, other := range z.records {
+		if other.ID == rec.ID || other.Name != rec.Name {
+			continue
+		}
+		switch {
+		case other.Type == rec.Type && other.Content == rec.Content:
+			return &recordError{http.StatusBadRequest, codeIdenticalRecord, "An identical record already exists."}
+		case other.Type == "CNAME":
+			return &recordError{http.StatusBadRequest, codeCNAMEConflict, "A CNAME record with that host already exists."}
+		case rec.Type == "CNAME":
+			return &recordError{http.StatusBadRequest, codeRecordAlreadyExists,
+				"An A, AAAA, or CNAME record with that host already exists."}
+		}
+	}
+	return nil
+}
+
+func (z *zone) sorted() []Record {
+	records := make([]Record, 0, len(z.records))
+	for _, rec := range z.records {
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		return records[i].ID < records[j].ID
+	})
+	return records
+}
@@ -0,0 +1,476 @@
+// Package cfemulator is an in-memory stand-in for the parts of the Cloudflare
+// API the controller uses: DNS records, zones and Cloudflare Tunnels. It is
+// meant for integration and e2e tests; point the client at it with
+// cloudflare.WithBaseURL. Faults such as 429s, 5xx errors and latency can be
+// injected with Inject, or over HTTP through AdminHandler.
+package cfemulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// basePath is accepted as an optional prefix, so the emulator can be used as
+// a drop-in for https://api.cloudflare.com/client/v4.
+const basePath = "/client/v4"
+
+// Cloudflare error codes returned by the emulator.
+const (
+	codeAuthentication      = 10000
+	codeInvalidRequest      = 1004
+	codeRouteNotFound       = 7003
+	codeRecordNotFound      = 81044
+	codeRecordAlreadyExists = 81053
+	codeCNAMEConflict       = 81054
+	codeIdenticalRecord     = 81057
+	codeRateLimited         = 971
+	codeInternal            = 10001
+)
+
+// Emulator serves the Cloudflare API from memory. It is safe for concurrent use.
+type Emulator struct {
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	token    string
+	apiEmail string
+	apiKey   string
+	perms    []string
+	pageCap  int
+	zones    map[string]*zone
+	tunnels  map[string]map[string]*Tunnel
+	faults   []*Fault
+	requests []Request
+	nextID   int
+}
+
+// Zone is a Cloudflare zone.
+type Zone struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+type zone struct {
+	Zone
+	records map[string]Record
+}
+
+// Record is a DNS record as returned by the API.
+type Record struct {
+	ID         string    `json:"id"`
+	ZoneID     string    `json:"zone_id"`
+	ZoneName   string    `json:"zone_name"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Content    string    `json:"content"`
+	Proxied    bool      `json:"proxied"`
+	Proxiable  bool      `json:"proxiable"`
+	TTL        int       `json:"ttl"`
+	Comment    string    `json:"comment"`
+	Tags       []string  `json:"tags"`
+	CreatedOn  time.Time `json:"created_on"`
+	ModifiedOn time.Time `json:"modified_on"`
+}
+
+// Tunnel is a Cloudflare Tunnel of an account.
+type Tunnel struct {
+	ID         string    `json:"id"`
+	AccountTag string    `json:"account_tag"`
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	TunType    string    `json:"tun_type"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Request is a request received by the emulator, without the base path.
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// Fault makes matching requests wait for Latency and, when Status is set,
+// fail with that status. Method and PathPrefix match any request when empty.
+// Times limits how many requests fail; 0 means until ClearFaults.
+type Fault struct {
+	Method     string
+	PathPrefix string
+	Status     int
+	RetryAfter time.Duration
+	Latency    time.Duration
+	Times      int
+}
+
+func New() *Emulator {
+	e := &Emulator{
+		mux:     http.NewServeMux(),
+		zones:   map[string]*zone{},
+		tunnels: map[string]map[string]*Tunnel{},
+		perms:   []string{"Zone Read", "DNS Write"},
+	}
+	e.mux.HandleFunc("GET /user", e.getUser)
+	e.mux.HandleFunc("GET /user/tokens/verify", e.verifyToken)
+	e.mux.HandleFunc("GET /user/tokens/{token_id}", e.getToken)
+	e.mux.HandleFunc("GET /zones", e.listZones)
+	e.mux.HandleFunc("GET /zones/{zone_id}", e.getZone)
+	e.mux.HandleFunc("GET /zones/{zone_id}/dns_records", e.listRecords)
+	e.mux.HandleFunc("POST /zones/{zone_id}/dns_records", e.createRecord)
+	e.mux.HandleFunc("POST /zones/{zone_id}/dns_records/batch", e.batchRecords)
+	e.mux.HandleFunc("GET /zones/{zone_id}/dns_records/{id}", e.getRecord)
+	e.mux.HandleFunc("PATCH /zones/{zone_id}/dns_records/{id}", e.editRecord)
+	e.mux.HandleFunc("PUT /zones/{zone_id}/dns_records/{id}", e.updateRecord)
+	e.mux.HandleFunc("DELETE /zones/{zone_id}/dns_records/{id}", e.deleteRecord)
+	e.mux.HandleFunc("GET /accounts/{account_id}/cfd_tunnel", e.listTunnels)
+	e.mux.HandleFunc("GET /accounts/{account_id}/cfd_tunnel/{tunnel_id}", e.getTunnel)
+	e.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, codeRouteNotFound, "No route for that URI")
+	})
+	return e
+}
+
+// RequireToken rejects requests that do not carry token as a bearer token or
+// the key set with RequireAPIKey. By default any credentials are accepted.
+func (e *Emulator) RequireToken(token string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.token = token
+}
+
+// RequireAPIKey accepts a Global API Key and email, see RequireToken.
+func (e *Emulator) RequireAPIKey(email, key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.apiEmail, e.apiKey = email, key
+}
+
+// SetMaxPerPage caps the per_page of listings at n, as some proxies do, so
+// clients must follow the reported total_pages. 0 removes the cap.
+func (e *Emulator) SetMaxPerPage(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pageCap = n
+}
+
+// SetTokenPermissions sets the permission groups, such as "DNS Write", that the
+// token's policy grants on all zones. It defaults to Zone Read and DNS Write.
+func (e *Emulator) SetTokenPermissions(names ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.perms = names
+}
+
+// AddZone creates an empty zone.
+func (e *Emulator) AddZone(id, name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.zones[id] = &zone{Zone: Zone{ID: id, Name: name, Status: "active"}, records: map[string]Record{}}
+}
+
+// AddTunnel creates a healthy tunnel in accountID.
+func (e *Emulator) AddTunnel(accountID, id, name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.tunnels[accountID] == nil {
+		e.tunnels[accountID] = map[string]*Tunnel{}
+	}
+	e.tunnels[accountID][id] = &Tunnel{
+		ID:         id,
+		AccountTag: accountID,
+		Name:       name,
+		Status:     "healthy",
+		TunType:    "cfd_tunnel",
+		CreatedAt:  time.Now().UTC(),
+	}
+}
+
+// AddRecord stores rec in zoneID as is, assigning an ID when empty, and
+// returns it. It panics if the zone does not exist.
+func (e *Emulator) AddRecord(zoneID string, rec Record) Record {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	z, ok := e.zones[zoneID]
+	if !ok {
+		panic(fmt.Sprintf("cfemulator: zone %s does not exist", zoneID))
+	}
+	rec = e.newRecord(z, rec)
+	z.records[rec.ID] = rec
+	return rec
+}
+
+// Records returns the records of zoneID sorted by name.
+func (e *Emulator) Records(zoneID string) []Record {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	z, ok := e.zones[zoneID]
+	if !ok {
+		return nil
+	}
+	return z.sorted()
+}
+
+// Inject adds a fault. Faults are matched in the order they were added.
+func (e *Emulator) Inject(f Fault) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.faults = append(e.faults, &f)
+}
+
+// ClearFaults removes every injected fault.
+func (e *Emulator) ClearFaults() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.faults = nil
+}
+
+// Requests returns the requests received so far, including failed ones.
+func (e *Emulator) Requests() []Request {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Request(nil), e.requests...)
+}
+
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, basePath)
+	if path == "" {
+		path = "/"
+	}
+	r.URL.Path = path
+	r.URL.RawPath = ""
+
+	e.mu.Lock()
+	e.requests = append(e.requests, Request{Method: r.Method, Path: path})
+	fault := e.matchFault(r.Method, path)
+	authorized := e.authorized(r)
+	e.mu.Unlock()
+
+	if fault != nil {
+		if fault.Latency > 0 {
+			select {
+			case <-time.After(fault.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault.Status != 0 {
+			writeFault(w, fault)
+			return
+		}
+	}
+	if !authorized {
+		writeError(w, http.StatusUnauthorized, codeAuthentication, "Authentication error")
+		return
+	}
+	e.mux.ServeHTTP(w, r)
+}
+
+// matchFault returns the first fault matching the request and consumes one
+// of its Times. e.mu must be held.
+func (e *Emulator) matchFault(method, path string) *Fault {
+	for i, f := range e.faults {
+		if (f.Method != "" && f.Method != method) || !strings.HasPrefix(path, f.PathPrefix) {
+			continue
+		}
+		matched := *f
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				e.faults = append(e.faults[:i:i], e.faults[i+1:]...)
+			}
+		}
+		return &matched
+	}
+	return nil
+}
+
+// authorized checks the request's credentials. e.mu must be held.
+func (e *Emulator) authorized(r *http.Request) bool {
+	if e.token == "" && e.apiKey == "" {
+		return true
+	}
+	if e.token != "" && r.Header.Get("Authorization") == "Bearer "+e.token {
+		return true
+	}
+	return e.apiKey != "" && r.Header.Get("X-Auth-Key") == e.apiKey && r.Header.Get("X-Auth-Email") == e.apiEmail
+}
+
+func (e *Emulator) getUser(w http.ResponseWriter, r *http.Request) {
+	writeResult(w, http.StatusOK, map[string]any{"id": "cfemulator-user", "email": r.Header.Get("X-Auth-Email")})
+}
+
+func (e *Emulator) verifyToken(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeError(w, http.StatusBadRequest, codeAuthentication, "Invalid API Token")
+		return
+	}
+	writeResult(w, http.StatusOK, map[string]any{"id": "cfemulator-token", "status": "active"})
+}
+
+func (e *Emulator) getToken(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("token_id") != "cfemulator-token" {
+		writeError(w, http.StatusNotFound, codeInvalidRequest, "Invalid token")
+		return
+	}
+	e.mu.Lock()
+	groups := []map[string]string{}
+	for _, name := range e.perms {
+		groups = append(groups, map[string]string{"id": strings.ToLower(strings.ReplaceAll(name, " ", "-")), "name": name})
+	}
+	e.mu.Unlock()
+	writeResult(w, http.StatusOK, map[string]any{
+		"id":     "cfemulator-token",
+		"name":   "cfemulator",
+		"status": "active",
+		"policies": []map[string]any{{
+			"id":                "cfemulator-policy",
+			"effect":            "allow",
+			"permission_groups": groups,
+			"resources":         map[string]string{"com.cloudflare.api.account.zone.*": "*"},
+		}},
+	})
+}
+
+func (e *Emulator) listZones(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	var zones []Zone
+	for _, z := range e.zones {
+		if name := r.URL.Query().Get("name"); name == "" || name == z.Name {
+			zones = append(zones, z.Zone)
+		}
+	}
+	pageCap := e.pageCap
+	e.mu.Unlock()
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Name < zones[j].Name })
+	writePage(w, r, zones, pageCap)
+}
+
+func (e *Emulator) getZone(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	z, ok := e.zones[r.PathValue("zone_id")]
+	e.mu.Unlock()
+	if !ok {
+		writeZoneNotFound(w, r)
+		return
+	}
+	writeResult(w, http.StatusOK, z.Zone)
+}
+
+func (e *Emulator) listTunnels(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	var tunnels []Tunnel
+	for _, t := range e.tunnels[r.PathValue("account_id")] {
+		if name := r.URL.Query().Get("name"); name == "" || name == t.Name {
+			tunnels = append(tunnels, *t)
+		}
+	}
+	pageCap := e.pageCap
+	e.mu.Unlock()
+	sort.Slice(tunnels, func(i, j int) bool { return tunnels[i].Name < tunnels[j].Name })
+	writePage(w, r, tunnels, pageCap)
+}
+
+func (e *Emulator) getTunnel(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	t, ok := e.tunnels[r.PathValue("account_id")][r.PathValue("tunnel_id")]
+	e.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, codeRouteNotFound, "Tunnel not found")
+		return
+	}
+	writeResult(w, http.StatusOK, t)
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type envelope struct {
+	Success    bool        `json:"success"`
+	Errors     []apiError  `json:"errors"`
+	Messages   []apiError  `json:"messages"`
+	Result     any         `json:"result"`
+	ResultInfo *resultInfo `json:"result_info,omitempty"`
+}
+
+type resultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Count      int `json:"count"`
+	TotalCount int `json:"total_count"`
+	TotalPages int `json:"total_pages"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body envelope) {
+	if body.Errors == nil {
+		body.Errors = []apiError{}
+	}
+	body.Messages = []apiError{}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeResult(w http.ResponseWriter, status int, result any) {
+	writeJSON(w, status, envelope{Success: true, Result: result})
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, envelope{Errors: []apiError{{Code: code, Message: message}}})
+}
+
+func writeZoneNotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, codeRouteNotFound,
+		fmt.Sprintf("Could not route to %s, perhaps your object identifier is invalid?", r.URL.Path))
+}
+
+func writeFault(w http.ResponseWriter, f *Fault) {
+	switch {
+	case f.Status == http.StatusTooManyRequests:
+		if f.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((f.RetryAfter+time.Second-1)/time.Second)))
+		}
+		writeError(w, f.Status, codeRateLimited, "Please wait and consider throttling your request speed")
+	default:
+		writeError(w, f.Status, codeInternal, http.StatusText(f.Status))
+	}
+}
+
+// writePage writes the page of items selected by the page and per_page query
+// parameters, defaulting to the first 100 items. per_page is capped at pageCap
+// when it is set.
+func writePage[T any](w http.ResponseWriter, r *http.Request, items []T, pageCap int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 {
+		perPage = 100
+	}
+	if pageCap > 0 {
+		perPage = min(perPage, pageCap)
+	}
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	result := items[start:end]
+	if result == nil {
+		result = []T{}
+	}
+	writeJSON(w, http.StatusOK, envelope{
+		Success: true,
+		Result:  result,
+		ResultInfo: &resultInfo{
+			Page:       page,
+			PerPage:    perPage,
+			Count:      len(result),
+			TotalCount: len(items),
+			TotalPages: (len(items) + perPage - 1) / perPage,
+		},
+	})
+}
@@ -0,0 +1,126 @@
+package cfemulator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func do(t *testing.T, h http.Handler, method, path, body string) (int, envelope) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var env envelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("%s %s: invalid response %q", method, path, rec.Body.String())
+	}
+	return rec.Code, env
+}
+
+func TestPagination(t *testing.T) {
+	e := New()
+	e.AddZone("z", "example.com")
+	for _, name := range []string{"c.example.com", "a.example.com", "b.example.com"} {
+		e.AddRecord("z", Record{Name: name, Type: "CNAME", Content: "t.cfargotunnel.com"})
+	}
+
+	code, env := do(t, e, http.MethodGet, "/client/v4/zones/z/dns_records?per_page=2&page=2", "")
+	if code != http.StatusOK || env.ResultInfo.TotalCount != 3 || env.ResultInfo.Count != 1 {
+		t.Fatalf("GET page 2 = %d %+v", code, env.ResultInfo)
+	}
+	if got := env.Result.([]any)[0].(map[string]any)["name"]; got != "c.example.com" {
+		t.Errorf("page 2 holds %v, want c.example.com", got)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	e := New()
+	e.AddZone("z", "example.com")
+	e.Inject(Fault{Method: http.MethodPost, PathPrefix: "/zones/z/dns_records", Status: http.StatusBadGateway, Times: 1})
+
+	body := `{"name":"a.example.com","type":"CNAME","content":"t.cfargotunnel.com"}`
+	if code, _ := do(t, e, http.MethodGet, "/zones/z/dns_records", ""); code != http.StatusOK {
+		t.Errorf("GET should not match a POST fault, got %d", code)
+	}
+	if code, _ := do(t, e, http.MethodPost, "/zones/z/dns_records", body); code != http.StatusBadGateway {
+		t.Errorf("first POST = %d, want 502", code)
+	}
+	if code, _ := do(t, e, http.MethodPost, "/zones/z/dns_records", body); code != http.StatusOK {
+		t.Errorf("second POST = %d, want 200 once the fault is used up", code)
+	}
+	if code, env := do(t, e, http.MethodPost, "/zones/z/dns_records", body); code != http.StatusBadRequest ||
+		env.Errors[0].Code != codeIdenticalRecord {
+		t.Errorf("duplicate POST = %d %+v, want %d", code, env.Errors, codeIdenticalRecord)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	e := New()
+	e.AddZone("z", "example.com")
+	e.RequireToken("secret")
+
+	if code, _ := do(t, e, http.MethodGet, "/zones/z", ""); code != http.StatusUnauthorized {
+		t.Errorf("GET without a token = %d, want 401", code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/zones/z", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET with the token = %d, want 200", rec.Code)
+	}
+}
+
+func TestAdminFaults(t *testing.T) {
+	e := New()
+	e.AddZone("z", "example.com")
+	admin := e.AdminHandler()
+
+	fault := `{"method":"POST","pathPrefix":"/zones/z/dns_records","status":429,"retryAfter":"3s","times":1}`
+	if code, env := do(t, admin, http.MethodPost, "/__emulator/faults", fault); code != http.StatusOK {
+		t.Fatalf("POST fault = %d %+v", code, env.Errors)
+	}
+	if code, _ := do(t, admin, http.MethodPost, "/__emulator/faults", `{"latency":"soon"}`); code != 400 {
+		t.Errorf("POST invalid fault = %d, want 400", code)
+	}
+	if _, env := do(t, admin, http.MethodGet, "/__emulator/faults", ""); len(env.Result.([]any)) != 1 {
+		t.Errorf("GET faults = %v, want one fault", env.Result)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/zones/z/dns_records",
+		strings.NewReader(`{"name":"a.example.com","type":"CNAME","content":"t.cfargotunnel.com"}`))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3" {
+		t.Errorf("POST record = %d Retry-After %q, want 429 after 3s", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if _, env := do(t, admin, http.MethodGet, "/__emulator/faults", ""); len(env.Result.([]any)) != 0 {
+		t.Errorf("GET faults = %v, want the fault used up", env.Result)
+	}
+
+	e.Inject(Fault{Status: http.StatusBadGateway})
+	code, _ := do(t, admin, http.MethodDelete, "/__emulator/faults", "")
+	if code != http.StatusOK || len(e.Faults()) != 0 {
+		t.Errorf("DELETE faults = %d, %d faults left", code, len(e.Faults()))
+	}
+	if _, env := do(t, admin, http.MethodGet, "/__emulator/requests", ""); len(env.Result.([]any)) != 1 {
+		t.Errorf("GET requests = %v, want the one API request", env.Result)
+	}
+}
+
+func TestTokenPermissions(t *testing.T) {
+	e := New()
+	e.SetTokenPermissions("DNS Read")
+	code, env := do(t, e, http.MethodGet, "/user/tokens/cfemulator-token", "")
+	if code != http.StatusOK {
+		t.Fatalf("GET token = %d %+v", code, env.Errors)
+	}
+	policies := env.Result.(map[string]any)["policies"].([]any)
+	groups := policies[0].(map[string]any)["permission_groups"].([]any)
+	if len(groups) != 1 || groups[0].(map[string]any)["name"] != "DNS Read" {
+		t.Errorf("permission groups = %v, want DNS Read", groups)
+	}
+}
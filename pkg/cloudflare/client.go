@@ -3,19 +3,30 @@ package cloudflare
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/cloudflare/cloudflare-go/v6"
 	"github.com/cloudflare/cloudflare-go/v6/dns"
 	"github.com/cloudflare/cloudflare-go/v6/option"
+	"github.com/cloudflare/cloudflare-go/v6/packages/pagination"
+	"golang.org/x/time/rate"
 )
 
 type Client interface {
 	ListDNSRecords(ctx context.Context) ([]DNSRecord, error)
-	CreateDNSRecord(ctx context.Context, record DNSRecord) error
+	CreateDNSRecord(ctx context.Context, record DNSRecord) (DNSRecord, error)
+	UpdateDNSRecord(ctx context.Context, record DNSRecord) error
 	DeleteDNSRecord(ctx context.Context, recordID string) error
+	ApplyPlan(ctx context.Context, plan Plan) ([]BatchResult, error)
 	IsTunnelRecord(rec DNSRecord, tunnelID string) bool
 }
 
+// Zoner is implemented by clients that know the zone they manage.
+type Zoner interface {
+	ZoneID(ctx context.Context) string
+}
+
 type DNSRecord struct {
 	ID      string
 	Name    string // hostname (e.g., "hoge.example.com")
@@ -23,66 +34,128 @@ type DNSRecord struct {
 	Content string // target (e.g., "<tunnel-id>.cfargotunnel.com")
 	Proxied bool
 	TTL     int
+	Comment string
+	Tags    []string
 }
 
 type client struct {
-	cf     *cloudflare.Client
-	zoneID string
+	cf        *cloudflare.Client
+	zoneID    string
+	retry     retryPolicy
+	limiter   *rate.Limiter
+	batchSize int
+	// auth is the token, or the email and key set by WithAPIKey.
+	auth   []option.RequestOption
+	apiKey bool
+	// requestOptions are passed to the SDK after auth, see transport.go.
+	requestOptions []option.RequestOption
 }
 
-func NewClient(token, zoneID string) Client {
-	cfClient := cloudflare.NewClient(
-		option.WithAPIToken(token),
-	)
-	return &client{
-		cf:     cfClient,
-		zoneID: zoneID,
+type Option func(*client)
+
+// WithAPIKey authenticates with a Global API Key and its account email instead
+// of the token passed to NewClient. The key grants full account access, so
+// scoped tokens should be preferred.
+func WithAPIKey(email, key string) Option {
+	return func(c *client) {
+		c.auth = []option.RequestOption{
+			// Drop a token picked up from CLOUDFLARE_API_TOKEN by the SDK defaults.
+			option.WithHeaderDel("authorization"),
+			option.WithAPIEmail(email),
+			option.WithAPIKey(key),
+		}
+		c.apiKey = true
 	}
 }
 
-func (c *client) ListDNSRecords(ctx context.Context) ([]DNSRecord, error) {
-	page, err := c.cf.DNS.Records.List(ctx, dns.RecordListParams{
-		ZoneID: cloudflare.F(c.zoneID),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list DNS records: %w", err)
+// WithRetry overrides how often transient and rate-limited calls are retried.
+func WithRetry(maxAttempts int, baseDelay, maxDelay time.Duration) Option {
+	return func(c *client) {
+		c.retry = retryPolicy{maxAttempts: maxAttempts, baseDelay: baseDelay, maxDelay: maxDelay}
 	}
+}
 
-	records := make([]DNSRecord, 0, len(page.Result))
-	for _, r := range page.Result {
-		records = append(records, DNSRecord{
-			ID:      r.ID,
-			Name:    r.Name,
-			Type:    string(r.Type),
-			Content: r.Content,
-			Proxied: r.Proxied,
-			TTL:     int(r.TTL),
+func NewClient(token, zoneID string, opts ...Option) Client {
+	c := &client{
+		zoneID:    zoneID,
+		retry:     defaultRetryPolicy,
+		batchSize: defaultBatchSize,
+		auth:      []option.RequestOption{option.WithAPIToken(token)},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	reqOpts := append(c.auth, c.requestOptions...)
+	// Retries are handled by retryPolicy so errors can be classified first.
+	c.cf = cloudflare.NewClient(append(reqOpts, option.WithMaxRetries(0))...)
+	return c
+}
+
+// listPageSize is the number of records requested per page when listing.
+const listPageSize = 1000
+
+func (c *client) ListDNSRecords(ctx context.Context) ([]DNSRecord, error) {
+	var records []DNSRecord
+	for pageNumber := 1; ; pageNumber++ {
+		var page *pagination.V4PagePaginationArray[dns.RecordResponse]
+		err := c.do(ctx, "list", func() (err error) {
+			page, err = c.cf.DNS.Records.List(ctx, dns.RecordListParams{
+				ZoneID:  cloudflare.F(c.zoneID),
+				Page:    cloudflare.F(float64(pageNumber)),
+				PerPage: cloudflare.F(float64(listPageSize)),
+			})
+			return err
 		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list DNS records: %w", err)
+		}
+		for _, r := range page.Result {
+			records = append(records, fromResponse(r))
+		}
+		// The server may return fewer records than asked for per page, so
+		// stop on the reported page count, or on an empty page without one.
+		totalPages, parseErr := strconv.Atoi(page.ResultInfo.JSON.ExtraFields["total_pages"].Raw())
+		if len(page.Result) == 0 || (parseErr == nil && pageNumber >= totalPages) {
+			return records, nil
+		}
 	}
+}
 
-	return records, nil
+func (c *client) CreateDNSRecord(ctx context.Context, record DNSRecord) (DNSRecord, error) {
+	var res *dns.RecordResponse
+	err := c.do(ctx, "create", func() (err error) {
+		res, err = c.cf.DNS.Records.New(ctx, dns.RecordNewParams{
+			ZoneID: cloudflare.F(c.zoneID),
+			Body:   cnameParam(record),
+		})
+		return err
+	})
+	if err != nil {
+		return DNSRecord{}, fmt.Errorf("failed to create DNS record %s: %w", record.Name, err)
+	}
+	return fromResponse(*res), nil
 }
 
-func (c *client) CreateDNSRecord(ctx context.Context, record DNSRecord) error {
-	_, err := c.cf.DNS.Records.New(ctx, dns.RecordNewParams{
-		ZoneID: cloudflare.F(c.zoneID),
-		Body: dns.CNAMERecordParam{
-			Name:    cloudflare.F(record.Name),
-			Content: cloudflare.F(record.Content),
-			Type:    cloudflare.F(dns.CNAMERecordTypeCNAME),
-			Proxied: cloudflare.F(record.Proxied),
-			TTL:     cloudflare.F(dns.TTL(record.TTL)),
-		},
+func (c *client) UpdateDNSRecord(ctx context.Context, record DNSRecord) error {
+	err := c.do(ctx, "update", func() error {
+		_, err := c.cf.DNS.Records.Edit(ctx, record.ID, dns.RecordEditParams{
+			ZoneID: cloudflare.F(c.zoneID),
+			Body:   cnameParam(record),
+		})
+		return err
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create DNS record %s: %w", record.Name, err)
+		return fmt.Errorf("failed to update DNS record %s: %w", record.Name, err)
 	}
 	return nil
 }
 
 func (c *client) DeleteDNSRecord(ctx context.Context, recordID string) error {
-	_, err := c.cf.DNS.Records.Delete(ctx, recordID, dns.RecordDeleteParams{
-		ZoneID: cloudflare.F(c.zoneID),
+	err := c.do(ctx, "delete", func() error {
+		_, err := c.cf.DNS.Records.Delete(ctx, recordID, dns.RecordDeleteParams{
+			ZoneID: cloudflare.F(c.zoneID),
+		})
+		return err
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete DNS record %s: %w", recordID, err)
@@ -90,7 +163,57 @@ func (c *client) DeleteDNSRecord(ctx context.Context, recordID string) error {
 	return nil
 }
 
+func (c *client) ZoneID(context.Context) string {
+	return c.zoneID
+}
+
 func (r *client) IsTunnelRecord(rec DNSRecord, tunnelID string) bool {
 	return rec.Type == "CNAME" &&
 		rec.Content == tunnelID+".cfargotunnel.com"
 }
+
+func fromResponse(r dns.RecordResponse) DNSRecord {
+	return DNSRecord{
+		ID:      r.ID,
+		Name:    r.Name,
+		Type:    string(r.Type),
+		Content: r.Content,
+		Proxied: r.Proxied,
+		TTL:     int(r.TTL),
+		Comment: r.Comment,
+		Tags:    tags(r.Tags),
+	}
+}
+
+func cnameParam(record DNSRecord) dns.CNAMERecordParam {
+	tags := record.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return dns.CNAMERecordParam{
+		Name:    cloudflare.F(record.Name),
+		Content: cloudflare.F(record.Content),
+		Type:    cloudflare.F(dns.CNAMERecordTypeCNAME),
+		Proxied: cloudflare.F(record.Proxied),
+		TTL:     cloudflare.F(dns.TTL(record.TTL)),
+		Comment: cloudflare.F(record.Comment),
+		Tags:    cloudflare.F(tags),
+	}
+}
+
+// tags converts the untyped tags field of a record response.
+func tags(v interface{}) []string {
+	switch items := v.(type) {
+	case []string:
+		return items
+	case []interface{}:
+		result := make([]string, 0, len(items))
+		for _, item := range items {
+			if tag, ok := item.(string); ok {
+				result = append(result, tag)
+			}
+		}
+		return result
+	}
+	return nil
+}
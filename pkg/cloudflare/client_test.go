@@ -0,0 +1,179 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare/cfemulator"
+)
+
+// newEmulator serves an emulator with zone-1 that only accepts "token".
+func newEmulator(t *testing.T) (*cfemulator.Emulator, string) {
+	t.Helper()
+	emu := cfemulator.New()
+	emu.AddZone("zone-1", "example.com")
+	emu.RequireToken("token")
+	srv := httptest.NewServer(emu)
+	t.Cleanup(srv.Close)
+	return emu, srv.URL
+}
+
+func newEmulatedClient(t *testing.T, opts ...Option) (Client, *cfemulator.Emulator) {
+	t.Helper()
+	emu, url := newEmulator(t)
+	opts = append([]Option{WithBaseURL(url), WithRetry(1, 0, 0)}, opts...)
+	return NewClient("token", "zone-1", opts...), emu
+}
+
+func TestClientListFollowsTotalPages(t *testing.T) {
+	c, emu := newEmulatedClient(t)
+	emu.SetMaxPerPage(2)
+	for i := range 5 {
+		name := fmt.Sprintf("host-%d.example.com", i)
+		emu.AddRecord("zone-1", cfemulator.Record{Name: name, Type: "A", Content: "192.0.2.1"})
+	}
+
+	recs, err := c.ListDNSRecords(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 5 {
+		t.Errorf("ListDNSRecords() returned %d records, want 5 over pages of 2", len(recs))
+	}
+	if got := len(emu.Requests()); got != 3 {
+		t.Errorf("listed %d pages, want 3", got)
+	}
+}
+
+func TestClientRecords(t *testing.T) {
+	ctx := context.Background()
+	c, emu := newEmulatedClient(t)
+	for i := range listPageSize + 5 {
+		emu.AddRecord("zone-1", cfemulator.Record{Name: fmt.Sprintf("host-%04d.example.com", i), Type: "A", Content: "192.0.2.1"})
+	}
+
+	recs, err := c.ListDNSRecords(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != listPageSize+5 {
+		t.Errorf("ListDNSRecords() returned %d records, want %d", len(recs), listPageSize+5)
+	}
+
+	rec := DNSRecord{Name: "api.example.com", Type: "CNAME", Content: "tunnel.cfargotunnel.com", Proxied: true, TTL: 1}
+	created, err := c.CreateDNSRecord(ctx, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateDNSRecord(ctx, rec); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreateDNSRecord() of a duplicate = %v, want ErrAlreadyExists", err)
+	}
+
+	created.Comment = "managed"
+	if err := c.UpdateDNSRecord(ctx, created); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteDNSRecord(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteDNSRecord(ctx, created.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteDNSRecord() of a deleted record = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClientApplyPlan(t *testing.T) {
+	ctx := context.Background()
+	c, emu := newEmulatedClient(t)
+	stale := emu.AddRecord("zone-1", cfemulator.Record{Name: "old.example.com", Type: "CNAME", Content: "t.cfargotunnel.com"})
+	drifted := emu.AddRecord("zone-1", cfemulator.Record{Name: "api.example.com", Type: "CNAME", Content: "t.cfargotunnel.com"})
+
+	results, err := c.ApplyPlan(ctx, Plan{
+		Creates: []DNSRecord{{Name: "new.example.com", Type: "CNAME", Content: "t.cfargotunnel.com", TTL: 1}},
+		Updates: []DNSRecord{{ID: drifted.ID, Name: "api.example.com", Type: "CNAME", Content: "t.cfargotunnel.com", Proxied: true, TTL: 1}},
+		Deletes: []DNSRecord{{ID: stale.ID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || len(results[0].Created) != 1 || results[0].Created[0].ID == "" {
+		t.Errorf("ApplyPlan() = %+v", results)
+	}
+	got := emu.Records("zone-1")
+	if len(got) != 2 || got[0].Name != "api.example.com" || !got[0].Proxied || got[1].Name != "new.example.com" {
+		t.Errorf("records after ApplyPlan() = %+v", got)
+	}
+
+	// A failing entry rolls back the whole batch.
+	_, err = c.ApplyPlan(ctx, Plan{
+		Creates: []DNSRecord{{Name: "other.example.com", Type: "CNAME", Content: "t.cfargotunnel.com", TTL: 1}},
+		Deletes: []DNSRecord{{ID: stale.ID}},
+	})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("ApplyPlan() with a missing record = %v, want ErrNotFound", err)
+	}
+	if len(emu.Records("zone-1")) != 2 {
+		t.Error("a failed batch should not change any record")
+	}
+}
+
+func TestClientApplyPlanChunks(t *testing.T) {
+	ctx := context.Background()
+	c, emu := newEmulatedClient(t, WithBatchSize(1))
+	first := emu.AddRecord("zone-1", cfemulator.Record{Name: "api.example.com", Type: "CNAME", Content: "t.cfargotunnel.com"})
+
+	// Batches are sent until one fails and each reports its own result.
+	results, err := c.ApplyPlan(ctx, Plan{
+		Deletes: []DNSRecord{
+			{ID: first.ID, Name: "api.example.com"},
+			{ID: "missing", Name: "old.example.com"},
+			{ID: "never-sent", Name: "other.example.com"},
+		},
+	})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ApplyPlan() = %v, want ErrNotFound", err)
+	}
+	if len(results) != 2 || results[0].Err != nil || results[0].Plan.Deletes[0].ID != first.ID ||
+		!errors.Is(results[1].Err, ErrNotFound) || results[1].Plan.Deletes[0].ID != "missing" {
+		t.Errorf("ApplyPlan() results = %+v", results)
+	}
+	if len(emu.Records("zone-1")) != 0 {
+		t.Error("the first batch should have been applied")
+	}
+}
+
+func TestClientFaults(t *testing.T) {
+	ctx := context.Background()
+
+	c, emu := newEmulatedClient(t)
+	emu.Inject(cfemulator.Fault{Status: http.StatusTooManyRequests, RetryAfter: 2 * time.Second, Times: 1})
+	_, err := c.ListDNSRecords(ctx)
+	if d, ok := RetryAfter(err); !ok || d != 2*time.Second {
+		t.Errorf("RetryAfter(%v) = %v, %v, want 2s", err, d, ok)
+	}
+
+	c, emu = newEmulatedClient(t, WithRetry(2, time.Millisecond, time.Millisecond))
+	emu.Inject(cfemulator.Fault{Method: http.MethodGet, Status: http.StatusServiceUnavailable, Times: 1})
+	if _, err := c.ListDNSRecords(ctx); err != nil {
+		t.Errorf("ListDNSRecords() should retry a 503, got %v", err)
+	}
+	if n := len(emu.Requests()); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+
+	c, emu = newEmulatedClient(t, WithRequestTimeout(10*time.Millisecond))
+	emu.Inject(cfemulator.Fault{Latency: 100 * time.Millisecond})
+	if _, err := c.ListDNSRecords(ctx); err == nil {
+		t.Error("ListDNSRecords() should time out")
+	}
+
+	_, url := newEmulator(t)
+	c = NewClient("wrong", "zone-1", WithBaseURL(url), WithRetry(1, 0, 0))
+	if _, err := c.ListDNSRecords(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("ListDNSRecords() with a wrong token = %v, want ErrUnauthorized", err)
+	}
+}
@@ -0,0 +1,144 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v6"
+)
+
+// Sentinel errors for the classes of Cloudflare API failures callers act on.
+// Errors returned by Client match them with errors.Is.
+var (
+	ErrRateLimited   = errors.New("cloudflare: rate limited")
+	ErrUnauthorized  = errors.New("cloudflare: unauthorized")
+	ErrNotFound      = errors.New("cloudflare: not found")
+	ErrAlreadyExists = errors.New("cloudflare: record already exists")
+	ErrTransient     = errors.New("cloudflare: transient error")
+)
+
+// Cloudflare error codes returned when a conflicting record already exists.
+const (
+	codeRecordAlreadyExists   = 81053 // An A, AAAA, or CNAME record with that host already exists.
+	codeIdenticalRecordExists = 81057 // An identical record already exists.
+	codeCNAMEConflict         = 81054 // A CNAME record with that host already exists.
+)
+
+// defaultRetryAfter is used when a 429 response carries no usable Retry-After header.
+const defaultRetryAfter = 30 * time.Second
+
+// APIError is a classified Cloudflare API failure. Kind is one of the sentinel errors.
+type APIError struct {
+	Kind       error
+	StatusCode int
+	RetryAfter time.Duration // set for ErrRateLimited
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+func (e *APIError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// RetryAfter reports whether err is a 429 response from the Cloudflare API and,
+// if so, how long the API asked callers to wait before trying again.
+func RetryAfter(err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Kind == ErrRateLimited {
+		return apiErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// classify wraps err into an *APIError when it matches one of the sentinel errors.
+func classify(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return err
+	}
+
+	var cfErr *cloudflare.Error
+	if !errors.As(err, &cfErr) {
+		if transientNetError(err) {
+			return &APIError{Kind: ErrTransient, Err: err}
+		}
+		return err
+	}
+
+	switch status := cfErr.StatusCode; {
+	case status == http.StatusTooManyRequests:
+		retryAfter := defaultRetryAfter
+		if cfErr.Response != nil {
+			retryAfter = parseRetryAfter(cfErr.Response.Header.Get("Retry-After"))
+		}
+		return &APIError{Kind: ErrRateLimited, StatusCode: status, RetryAfter: retryAfter, Err: err}
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return &APIError{Kind: ErrUnauthorized, StatusCode: status, Err: err}
+	case status == http.StatusNotFound:
+		return &APIError{Kind: ErrNotFound, StatusCode: status, Err: err}
+	case status >= http.StatusInternalServerError || status == http.StatusRequestTimeout:
+		return &APIError{Kind: ErrTransient, StatusCode: status, Err: err}
+	}
+	for _, e := range cfErr.Errors {
+		switch e.Code {
+		case codeRecordAlreadyExists, codeIdenticalRecordExists, codeCNAMEConflict:
+			return &APIError{Kind: ErrAlreadyExists, StatusCode: cfErr.StatusCode, Err: err}
+		}
+	}
+	return err
+}
+
+// transientNetError reports whether err is a network failure worth retrying: a
+// timeout, a reset or refused connection, or a response cut short. TLS,
+// certificate, DNS and proxy failures are permanent and left unclassified.
+func transientNetError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// statusCode returns the HTTP status code label of a request that returned err.
+// Requests that got no response are labeled "error".
+func statusCode(err error) string {
+	if err == nil {
+		return strconv.Itoa(http.StatusOK)
+	}
+	var cfErr *cloudflare.Error
+	if errors.As(err, &cfErr) {
+		return strconv.Itoa(cfErr.StatusCode)
+	}
+	return "error"
+}
+
+// parseRetryAfter accepts both forms of the Retry-After header: delay seconds and an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return defaultRetryAfter
+}
@@ -0,0 +1,169 @@
+package cloudflare
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v6"
+	"github.com/cloudflare/cloudflare-go/v6/shared"
+)
+
+func apiError(status int, header http.Header, codes ...int64) *cloudflare.Error {
+	errs := make([]shared.ErrorData, 0, len(codes))
+	for _, code := range codes {
+		errs = append(errs, shared.ErrorData{Code: code})
+	}
+	return &cloudflare.Error{
+		Errors:     errs,
+		StatusCode: status,
+		Request:    httptest.NewRequest(http.MethodGet, "https://api.cloudflare.com/client/v4/zones", nil),
+		Response:   &http.Response{StatusCode: status, Header: header},
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "rate limited", err: apiError(http.StatusTooManyRequests, http.Header{}), want: ErrRateLimited},
+		{name: "unauthorized", err: apiError(http.StatusUnauthorized, http.Header{}), want: ErrUnauthorized},
+		{name: "forbidden", err: apiError(http.StatusForbidden, http.Header{}), want: ErrUnauthorized},
+		{name: "not found", err: apiError(http.StatusNotFound, http.Header{}), want: ErrNotFound},
+		{name: "already exists", err: apiError(http.StatusBadRequest, http.Header{}, 81053), want: ErrAlreadyExists},
+		{name: "identical record", err: apiError(http.StatusBadRequest, http.Header{}, 81057), want: ErrAlreadyExists},
+		{name: "server error", err: apiError(http.StatusBadGateway, http.Header{}), want: ErrTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify(tt.err)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("classify() = %v, want %v", err, tt.want)
+			}
+			var cfErr *cloudflare.Error
+			if !errors.As(err, &cfErr) {
+				t.Errorf("classify() lost the original error")
+			}
+		})
+	}
+
+	if err := classify(apiError(http.StatusBadRequest, http.Header{}, 9999)); errors.Is(err, ErrTransient) {
+		t.Errorf("unexpected classification of bad request: %v", err)
+	}
+}
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyNetworkErrors(t *testing.T) {
+	urlError := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://api.cloudflare.com/client/v4/zones", Err: err}
+	}
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{name: "timeout", err: urlError(&net.OpError{Op: "read", Err: timeoutError{}}), transient: true},
+		{
+			name:      "connection refused",
+			err:       urlError(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}),
+			transient: true,
+		},
+		{
+			name:      "connection reset",
+			err:       urlError(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}),
+			transient: true,
+		},
+		{name: "unexpected EOF", err: urlError(io.ErrUnexpectedEOF), transient: true},
+		{name: "unknown authority", err: urlError(&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}})},
+		{name: "hostname mismatch", err: urlError(x509.HostnameError{Host: "api", Certificate: &x509.Certificate{}})},
+		{name: "no such host", err: urlError(&net.OpError{Op: "dial", Err: &net.DNSError{IsNotFound: true}})},
+		{name: "proxy auth", err: urlError(errors.New("proxyconnect tcp: Proxy Authentication Required"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(classify(tt.err), ErrTransient); got != tt.transient {
+				t.Errorf("classify(%v) transient = %v, want %v", tt.err, got, tt.transient)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	err := classify(apiError(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"7"}}))
+	retryAfter, ok := RetryAfter(err)
+	if !ok || retryAfter != 7*time.Second {
+		t.Errorf("RetryAfter() = (%v, %v), want (7s, true)", retryAfter, ok)
+	}
+	if _, ok := RetryAfter(errors.New("boom")); ok {
+		t.Error("RetryAfter() reported a plain error as rate limited")
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 3, baseDelay: time.Millisecond, maxDelay: 10 * time.Millisecond}
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		calls := 0
+		err := policy.do(context.Background(), func() error {
+			calls++
+			if calls < 3 {
+				return apiError(http.StatusServiceUnavailable, http.Header{})
+			}
+			return nil
+		})
+		if err != nil || calls != 3 {
+			t.Errorf("do() = %v after %d calls, want success after 3", err, calls)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		calls := 0
+		err := policy.do(context.Background(), func() error {
+			calls++
+			return apiError(http.StatusServiceUnavailable, http.Header{})
+		})
+		if !errors.Is(err, ErrTransient) || calls != 3 {
+			t.Errorf("do() = %v after %d calls, want transient error after 3", err, calls)
+		}
+	})
+
+	t.Run("does not retry permanent errors", func(t *testing.T) {
+		calls := 0
+		err := policy.do(context.Background(), func() error {
+			calls++
+			return apiError(http.StatusNotFound, http.Header{})
+		})
+		if !errors.Is(err, ErrNotFound) || calls != 1 {
+			t.Errorf("do() = %v after %d calls, want not found after 1", err, calls)
+		}
+	})
+
+	t.Run("returns long Retry-After to the caller", func(t *testing.T) {
+		calls := 0
+		err := policy.do(context.Background(), func() error {
+			calls++
+			return apiError(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"60"}})
+		})
+		if !errors.Is(err, ErrRateLimited) || calls != 1 {
+			t.Errorf("do() = %v after %d calls, want rate limited after 1", err, calls)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package cloudflare
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/metrics"
+)
+
+// WithRateLimit caps the request rate of the client with a token bucket, so every
+// reconcile sharing the client slows down together instead of hitting 429s.
+// A qps of 0 disables the limiter.
+func WithRateLimit(qps float64, burst int) Option {
+	return WithLimiter(NewLimiter(qps, burst))
+}
+
+// NewLimiter returns a token bucket for WithLimiter, or nil when qps is 0.
+func NewLimiter(qps float64, burst int) *rate.Limiter {
+	if qps <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
+
+// WithLimiter makes the client share limiter, so clients replaced at runtime
+// keep counting against the same rate limit. A nil limiter disables it.
+func WithLimiter(limiter *rate.Limiter) Option {
+	return func(c *client) {
+		c.limiter = limiter
+	}
+}
+
+// wait blocks until the limiter allows another request and records the time spent.
+func (c *client) wait(ctx context.Context) error {
+	if c.limiter == nil {
+		return nil
+	}
+	start := time.Now()
+	err := c.limiter.Wait(ctx)
+	metrics.CloudflareRateLimiterWait.Observe(time.Since(start).Seconds())
+	return err
+}
+
+// do runs fn under the retry policy, waiting for the rate limiter before every
+// attempt. Each attempt is recorded as a request of operation.
+func (c *client) do(ctx context.Context, operation string, fn func() error) error {
+	return c.retry.do(ctx, func() error {
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+		start := time.Now()
+		err := fn()
+		code := statusCode(err)
+		metrics.CloudflareRequests.WithLabelValues(operation, code).Inc()
+		metrics.CloudflareRequestDuration.WithLabelValues(operation, code).Observe(time.Since(start).Seconds())
+		return err
+	})
+}
@@ -0,0 +1,54 @@
+package cloudflare
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/metrics"
+)
+
+func TestRateLimit(t *testing.T) {
+	c := &client{retry: defaultRetryPolicy}
+	WithRateLimit(20, 1)(c)
+
+	start := time.Now()
+	for range 3 {
+		if err := c.do(context.Background(), "test", func() error { return nil }); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// The first call uses the burst, the next two wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 calls took %v, want at least 90ms", elapsed)
+	}
+
+	WithRateLimit(0, 0)(c)
+	if c.limiter != nil {
+		t.Error("qps 0 should disable the limiter")
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	c := &client{retry: retryPolicy{maxAttempts: 2, baseDelay: time.Millisecond, maxDelay: time.Millisecond}}
+
+	calls := 0
+	err := c.do(context.Background(), "metrics-test", func() error {
+		calls++
+		if calls == 1 {
+			return apiError(http.StatusBadGateway, http.Header{})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for code, want := range map[string]float64{"502": 1, "200": 1} {
+		if got := testutil.ToFloat64(metrics.CloudflareRequests.WithLabelValues("metrics-test", code)); got != want {
+			t.Errorf("requests with code %s = %v, want %v", code, got, want)
+		}
+	}
+}
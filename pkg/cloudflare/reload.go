@@ -0,0 +1,96 @@
+package cloudflare
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Pinner is implemented by clients whose underlying client can change. Pin
+// returns a context under which every call uses the client current at the time
+// of pinning, so a reconcile is never split across two clients.
+type Pinner interface {
+	Pin(ctx context.Context) context.Context
+}
+
+type pinnedKey struct{}
+
+// holder lets atomic.Pointer store a Client of any concrete type.
+type holder struct {
+	Client
+}
+
+// ReloadableClient delegates to a Client that can be swapped at runtime, for
+// example when credentials are rotated.
+type ReloadableClient struct {
+	current atomic.Pointer[holder]
+}
+
+func NewReloadableClient(initial Client) *ReloadableClient {
+	c := &ReloadableClient{}
+	c.Swap(initial)
+	return c
+}
+
+// Swap makes next the client of every call not pinned to an earlier one.
+func (c *ReloadableClient) Swap(next Client) {
+	c.current.Store(&holder{Client: next})
+}
+
+func (c *ReloadableClient) Pin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pinnedKey{}, c.current.Load().Client)
+}
+
+func (c *ReloadableClient) get(ctx context.Context) Client {
+	if pinned, ok := ctx.Value(pinnedKey{}).(Client); ok {
+		return pinned
+	}
+	return c.current.Load().Client
+}
+
+func (c *ReloadableClient) ListDNSRecords(ctx context.Context) ([]DNSRecord, error) {
+	return c.get(ctx).ListDNSRecords(ctx)
+}
+
+func (c *ReloadableClient) CreateDNSRecord(ctx context.Context, record DNSRecord) (DNSRecord, error) {
+	return c.get(ctx).CreateDNSRecord(ctx, record)
+}
+
+func (c *ReloadableClient) UpdateDNSRecord(ctx context.Context, record DNSRecord) error {
+	return c.get(ctx).UpdateDNSRecord(ctx, record)
+}
+
+func (c *ReloadableClient) DeleteDNSRecord(ctx context.Context, recordID string) error {
+	return c.get(ctx).DeleteDNSRecord(ctx, recordID)
+}
+
+func (c *ReloadableClient) ApplyPlan(ctx context.Context, plan Plan) ([]BatchResult, error) {
+	return c.get(ctx).ApplyPlan(ctx, plan)
+}
+
+func (c *ReloadableClient) IsTunnelRecord(rec DNSRecord, tunnelID string) bool {
+	return c.current.Load().IsTunnelRecord(rec, tunnelID)
+}
+
+func (c *ReloadableClient) RefreshDNSRecords(ctx context.Context) ([]DNSRecord, error) {
+	next := c.get(ctx)
+	if refresher, ok := next.(Refresher); ok {
+		return refresher.RefreshDNSRecords(ctx)
+	}
+	return next.ListDNSRecords(ctx)
+}
+
+// ZoneID returns the zone of the client ctx is pinned to, so it follows the
+// client when rotated credentials name another zone.
+func (c *ReloadableClient) ZoneID(ctx context.Context) string {
+	if z, ok := c.get(ctx).(Zoner); ok {
+		return z.ZoneID(ctx)
+	}
+	return ""
+}
+
+func (c *ReloadableClient) VerifyAccess(ctx context.Context) error {
+	if v, ok := c.get(ctx).(Verifier); ok {
+		return v.VerifyAccess(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package cloudflare
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReloadableClientPin(t *testing.T) {
+	oldClient := &countingClient{records: []DNSRecord{{ID: "old"}}}
+	newClient := &countingClient{records: []DNSRecord{{ID: "new"}}}
+	c := NewReloadableClient(oldClient)
+
+	pinned := c.Pin(context.Background())
+	c.Swap(newClient)
+
+	records, err := c.ListDNSRecords(pinned)
+	if err != nil || len(records) != 1 || records[0].ID != "old" {
+		t.Errorf("pinned ListDNSRecords() = %v, %v, want the old client's records", records, err)
+	}
+	records, err = c.ListDNSRecords(context.Background())
+	if err != nil || len(records) != 1 || records[0].ID != "new" {
+		t.Errorf("ListDNSRecords() = %v, %v, want the new client's records", records, err)
+	}
+}
+
+func TestReloadableClientZoneID(t *testing.T) {
+	c := NewReloadableClient(NewCachedClient(NewClient("token", "zone-old"), 0))
+	pinned := c.Pin(context.Background())
+	c.Swap(NewClient("token", "zone-new"))
+
+	if got := c.ZoneID(pinned); got != "zone-old" {
+		t.Errorf("pinned ZoneID() = %q, want zone-old", got)
+	}
+	if got := c.ZoneID(context.Background()); got != "zone-new" {
+		t.Errorf("ZoneID() = %q, want zone-new", got)
+	}
+}
@@ -0,0 +1,55 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// retryPolicy retries transient and rate-limited calls with bounded exponential backoff.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	maxAttempts: 4,
+	baseDelay:   500 * time.Millisecond,
+	maxDelay:    30 * time.Second,
+}
+
+// do calls fn until it succeeds, fails with a non-retryable error, or runs out of
+// attempts. A Retry-After longer than maxDelay is returned to the caller instead of
+// blocking, so the reconcile can be requeued.
+func (p retryPolicy) do(ctx context.Context, fn func() error) error {
+	delay := p.baseDelay
+	for attempt := 1; ; attempt++ {
+		err := classify(fn())
+		if err == nil || attempt >= p.maxAttempts {
+			return err
+		}
+
+		wait := delay
+		switch {
+		case errors.Is(err, ErrRateLimited):
+			retryAfter, _ := RetryAfter(err)
+			if retryAfter > p.maxDelay {
+				return err
+			}
+			wait = max(wait, retryAfter)
+		case errors.Is(err, ErrTransient):
+		default:
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay = min(delay*2, p.maxDelay)
+	}
+}
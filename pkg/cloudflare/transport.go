@@ -0,0 +1,92 @@
+package cloudflare
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v6/option"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// WithBaseURL sends requests to a Cloudflare-compatible API at baseURL, such
+// as a local emulator.
+func WithBaseURL(baseURL string) Option {
+	return func(c *client) {
+		c.requestOptions = append(c.requestOptions, option.WithBaseURL(baseURL))
+	}
+}
+
+// WithHTTPClient sends requests through hc, see NewHTTPClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *client) {
+		c.requestOptions = append(c.requestOptions, option.WithHTTPClient(hc))
+	}
+}
+
+// WithRequestTimeout bounds each request attempt. Retries get a fresh timeout.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(c *client) {
+		c.requestOptions = append(c.requestOptions, option.WithRequestTimeout(d))
+	}
+}
+
+// WithUserAgentSuffix appends suffix to the SDK's User-Agent header.
+func WithUserAgentSuffix(suffix string) Option {
+	return func(c *client) {
+		c.requestOptions = append(c.requestOptions, option.WithMiddleware(
+			func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+				req.Header.Set("User-Agent", req.Header.Get("User-Agent")+" "+suffix)
+				return next(req)
+			}))
+	}
+}
+
+// TransportConfig customizes the HTTP client used to reach Cloudflare.
+type TransportConfig struct {
+	// ProxyURL overrides the HTTPS_PROXY environment variable.
+	ProxyURL string
+	// CAFile is a PEM bundle trusted in addition to the system roots, such as
+	// the certificate of a TLS-intercepting egress proxy.
+	CAFile string
+}
+
+// NewHTTPClient returns an HTTP client for cfg, based on http.DefaultTransport.
+// Each request is traced as a child span of the caller's context.
+func NewHTTPClient(cfg TransportConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("CA bundle contains no PEM certificates")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &http.Client{Transport: otelhttp.NewTransport(transport,
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return "cloudflare " + r.Method
+		}),
+		// Record spans without sending traceparent or baggage to Cloudflare.
+		otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator()),
+	)}, nil
+}
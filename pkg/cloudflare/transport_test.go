@@ -0,0 +1,132 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTransportOptions(t *testing.T) {
+	var userAgent string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"success":true,"errors":[],"messages":[],"result":[],"result_info":{}}`))
+	}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, cert, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	hc, err := NewHTTPClient(TransportConfig{CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient("token", "zone-1",
+		WithBaseURL(srv.URL),
+		WithHTTPClient(hc),
+		WithUserAgentSuffix("cloudflared-dns-controller/test"),
+		WithRetry(1, 0, 0),
+	)
+	if _, err := c.ListDNSRecords(context.Background()); err != nil {
+		t.Fatalf("ListDNSRecords() = %v", err)
+	}
+	if !strings.HasPrefix(userAgent, "Cloudflare/Go") || !strings.HasSuffix(userAgent, " cloudflared-dns-controller/test") {
+		t.Errorf("User-Agent = %q", userAgent)
+	}
+
+	// The test server's certificate is not trusted without the CA bundle.
+	untrusted := NewClient("token", "zone-1", WithBaseURL(srv.URL), WithRetry(1, 0, 0))
+	if _, err := untrusted.ListDNSRecords(context.Background()); err == nil {
+		t.Error("ListDNSRecords() without the CA bundle should fail")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	c := NewClient("token", "zone-1", WithBaseURL(srv.URL), WithRequestTimeout(20*time.Millisecond), WithRetry(1, 0, 0))
+	if _, err := c.ListDNSRecords(context.Background()); err == nil {
+		t.Error("ListDNSRecords() should time out")
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	bad := filepath.Join(t.TempDir(), "bad.pem")
+	if err := os.WriteFile(bad, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHTTPClient(TransportConfig{CAFile: bad}); err == nil {
+		t.Error("NewHTTPClient() with an invalid CA bundle should fail")
+	}
+	if _, err := NewHTTPClient(TransportConfig{ProxyURL: "://proxy"}); err == nil {
+		t.Error("NewHTTPClient() with an invalid proxy URL should fail")
+	}
+}
+
+func TestHTTPClientTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+	previousPropagator := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	defer otel.SetTextMapPropagator(previousPropagator)
+
+	emu, _ := newEmulator(t)
+	var leaked []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, header := range []string{"Traceparent", "Baggage"} {
+			if r.Header.Get(header) != "" {
+				leaked = append(leaked, header)
+			}
+		}
+		emu.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	url := srv.URL
+	hc, err := NewHTTPClient(TransportConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient("token", "zone-1", WithBaseURL(url), WithHTTPClient(hc), WithRetry(1, 0, 0))
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "Reconcile")
+	if _, err := c.ListDNSRecords(ctx); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	var found bool
+	for _, span := range recorder.Ended() {
+		if span.Name() == "cloudflare GET" {
+			found = true
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("request span parent = %s, want the Reconcile span", span.Parent().SpanID())
+			}
+		}
+	}
+	if !found {
+		t.Error("no span recorded for the Cloudflare request")
+	}
+	if len(leaked) > 0 {
+		t.Errorf("trace headers %v were sent to Cloudflare", leaked)
+	}
+}
@@ -0,0 +1,185 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/cloudflare/cloudflare-go/v6"
+	"github.com/cloudflare/cloudflare-go/v6/dns"
+	"github.com/cloudflare/cloudflare-go/v6/shared"
+	"github.com/cloudflare/cloudflare-go/v6/user"
+	"github.com/cloudflare/cloudflare-go/v6/zones"
+)
+
+// Steps of VerifyAccess, reported as AccessError.Reason.
+const (
+	AccessReasonToken = "token"
+	AccessReasonZone  = "zone"
+	AccessReasonDNS   = "dns_records"
+	AccessReasonEdit  = "dns_edit"
+)
+
+// dnsWritePermission is the ID of Cloudflare's "DNS Write" permission group.
+const dnsWritePermission = "4755a26eedb94da69e1066d98aa820be"
+
+// errNoDNSWrite is reported when the token's policies do not grant DNS Write on the zone.
+var errNoDNSWrite = errors.New("token does not grant DNS Write on the zone")
+
+// Verifier is implemented by clients that can check their credentials.
+type Verifier interface {
+	VerifyAccess(ctx context.Context) error
+}
+
+// AccessError is returned by VerifyAccess with the step that failed.
+type AccessError struct {
+	Reason string
+	Err    error
+}
+
+func (e *AccessError) Error() string {
+	return fmt.Sprintf("cloudflare %s check failed: %v", e.Reason, e.Err)
+}
+
+func (e *AccessError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyAccess checks that the credentials are valid, that they can read the
+// zone and that they can list the zone's DNS records. For API tokens that may
+// read their own policies it also checks that they grant DNS Write on the
+// zone; other tokens and Global API Keys are not checked for edit access.
+func (c *client) VerifyAccess(ctx context.Context) error {
+	token, err := c.verifyCredentials(ctx)
+	if err != nil {
+		return &AccessError{Reason: AccessReasonToken, Err: err}
+	}
+
+	var zone *zones.Zone
+	err = c.do(ctx, "get_zone", func() (err error) {
+		zone, err = c.cf.Zones.Get(ctx, zones.ZoneGetParams{ZoneID: cloudflare.F(c.zoneID)})
+		return err
+	})
+	if err != nil {
+		return &AccessError{Reason: AccessReasonZone, Err: err}
+	}
+
+	err = c.do(ctx, "list", func() error {
+		_, err := c.cf.DNS.Records.List(ctx, dns.RecordListParams{
+			ZoneID:  cloudflare.F(c.zoneID),
+			PerPage: cloudflare.F(1.0),
+		})
+		return err
+	})
+	if err != nil {
+		return &AccessError{Reason: AccessReasonDNS, Err: err}
+	}
+
+	if token == "" {
+		return nil
+	}
+	if err := c.verifyDNSWrite(ctx, token, zone.Account.ID); err != nil {
+		return &AccessError{Reason: AccessReasonEdit, Err: err}
+	}
+	return nil
+}
+
+// verifyCredentials checks that the token is active and returns its ID. The
+// token endpoint rejects Global API Keys, so those are checked by reading the
+// user instead and return no ID.
+func (c *client) verifyCredentials(ctx context.Context) (string, error) {
+	if c.apiKey {
+		return "", c.do(ctx, "get_user", func() error {
+			_, err := c.cf.User.Get(ctx)
+			return err
+		})
+	}
+	var token *user.TokenVerifyResponse
+	err := c.do(ctx, "verify_token", func() (err error) {
+		token, err = c.cf.User.Tokens.Verify(ctx)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if token.Status != user.TokenVerifyResponseStatusActive {
+		return "", fmt.Errorf("token is %s", token.Status)
+	}
+	return token.ID, nil
+}
+
+// verifyDNSWrite checks that the token's policies grant DNS Write on the zone.
+// Reading a token's policies needs the API Tokens Read permission; tokens
+// without it cannot be checked and pass.
+func (c *client) verifyDNSWrite(ctx context.Context, tokenID, accountID string) error {
+	var token *shared.Token
+	err := c.do(ctx, "get_token", func() (err error) {
+		token, err = c.cf.User.Tokens.Get(ctx, tokenID)
+		return err
+	})
+	if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	allowed := false
+	for _, policy := range token.Policies {
+		if !grantsDNSWrite(policy) || !policyCoversZone(policy, c.zoneID, accountID) {
+			continue
+		}
+		if policy.Effect == shared.TokenPolicyEffectDeny {
+			return errNoDNSWrite
+		}
+		allowed = true
+	}
+	if !allowed {
+		return errNoDNSWrite
+	}
+	return nil
+}
+
+func grantsDNSWrite(policy shared.TokenPolicy) bool {
+	for _, group := range policy.PermissionGroups {
+		if group.ID == dnsWritePermission || group.Name == "DNS Write" {
+			return true
+		}
+	}
+	return false
+}
+
+// policyCoversZone reports whether the policy's resources include the zone,
+// either by name, through all zones, or through the zone's account.
+func policyCoversZone(policy shared.TokenPolicy, zoneID, accountID string) bool {
+	var resources map[string]any
+	if err := json.Unmarshal([]byte(policy.JSON.Resources.Raw()), &resources); err != nil {
+		return false
+	}
+	return resourcesCoverZone(resources, zoneID, accountID)
+}
+
+func resourcesCoverZone(resources map[string]any, zoneID, accountID string) bool {
+	for key, value := range resources {
+		switch key {
+		case "com.cloudflare.api.account.zone." + zoneID, "com.cloudflare.api.account.zone.*":
+			return true
+		case "com.cloudflare.api.account." + accountID, "com.cloudflare.api.account.*":
+			if value == "*" {
+				return true
+			}
+			if nested, ok := value.(map[string]any); ok && resourcesCoverZone(nested, zoneID, accountID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *cachedClient) VerifyAccess(ctx context.Context) error {
+	if v, ok := c.Client.(Verifier); ok {
+		return v.VerifyAccess(ctx)
+	}
+	return nil
+}
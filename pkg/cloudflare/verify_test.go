@@ -0,0 +1,131 @@
+package cloudflare
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go/v6"
+	"github.com/cloudflare/cloudflare-go/v6/option"
+)
+
+func TestVerifyAccess(t *testing.T) {
+	const (
+		dnsWrite = `{"id":"4755a26eedb94da69e1066d98aa820be","name":"DNS Write"}`
+		dnsRead  = `{"id":"82e64a83756745bbbb1c9c2701bf816b","name":"DNS Read"}`
+	)
+	policy := func(effect, group, resources string) string {
+		return `{"id":"p","effect":"` + effect + `","permission_groups":[` + group + `],"resources":` + resources + `}`
+	}
+	tests := []struct {
+		name       string
+		status     string
+		zoneStatus int
+		policies   string // empty when the token cannot read its policies
+		wantReason string
+	}{
+		{name: "ok", status: "active", zoneStatus: http.StatusOK,
+			policies: policy("allow", dnsWrite, `{"com.cloudflare.api.account.zone.zone-1":"*"}`)},
+		{name: "disabled token", status: "disabled", zoneStatus: http.StatusOK, wantReason: AccessReasonToken},
+		{name: "no zone access", status: "active", zoneStatus: http.StatusForbidden, wantReason: AccessReasonZone},
+		{name: "policies not readable", status: "active", zoneStatus: http.StatusOK},
+		{name: "DNS Write on the account", status: "active", zoneStatus: http.StatusOK,
+			policies: policy("allow", dnsWrite, `{"com.cloudflare.api.account.acct-1":`+
+				`{"com.cloudflare.api.account.zone.*":"*"}}`)},
+		{name: "DNS Read only", status: "active", zoneStatus: http.StatusOK,
+			policies: policy("allow", dnsRead, `{"com.cloudflare.api.account.zone.zone-1":"*"}`), wantReason: AccessReasonEdit},
+		{name: "DNS Write on another zone", status: "active", zoneStatus: http.StatusOK,
+			policies: policy("allow", dnsWrite, `{"com.cloudflare.api.account.zone.zone-2":"*"}`), wantReason: AccessReasonEdit},
+		{name: "DNS Write denied", status: "active", zoneStatus: http.StatusOK,
+			policies: policy("allow", dnsWrite, `{"com.cloudflare.api.account.zone.*":"*"}`) + "," +
+				policy("deny", dnsWrite, `{"com.cloudflare.api.account.zone.zone-1":"*"}`), wantReason: AccessReasonEdit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			writeJSON := func(w http.ResponseWriter, status int, body string) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(body))
+			}
+			mux.HandleFunc("GET /user/tokens/verify", func(w http.ResponseWriter, _ *http.Request) {
+				writeJSON(w, http.StatusOK,
+					`{"success":true,"errors":[],"messages":[],"result":{"id":"t","status":"`+tt.status+`"}}`)
+			})
+			mux.HandleFunc("GET /user/tokens/t", func(w http.ResponseWriter, _ *http.Request) {
+				if tt.policies == "" {
+					writeJSON(w, http.StatusForbidden,
+						`{"success":false,"errors":[{"code":9109,"message":"Unauthorized"}],"messages":[],"result":null}`)
+					return
+				}
+				writeJSON(w, http.StatusOK,
+					`{"success":true,"errors":[],"messages":[],"result":{"id":"t","policies":[`+tt.policies+`]}}`)
+			})
+			mux.HandleFunc("GET /zones/zone-1", func(w http.ResponseWriter, _ *http.Request) {
+				writeJSON(w, tt.zoneStatus,
+					`{"success":true,"errors":[],"messages":[],"result":{"id":"zone-1","account":{"id":"acct-1"}}}`)
+			})
+			mux.HandleFunc("GET /zones/zone-1/dns_records", func(w http.ResponseWriter, _ *http.Request) {
+				writeJSON(w, http.StatusOK, `{"success":true,"errors":[],"messages":[],"result":[],"result_info":{}}`)
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			c := &client{
+				cf: cloudflare.NewClient(
+					option.WithAPIToken("token"), option.WithBaseURL(srv.URL), option.WithMaxRetries(0),
+				),
+				zoneID: "zone-1",
+				retry:  retryPolicy{maxAttempts: 1},
+			}
+			err := c.VerifyAccess(context.Background())
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("VerifyAccess() = %v", err)
+				}
+				return
+			}
+			var accessErr *AccessError
+			if !errors.As(err, &accessErr) || accessErr.Reason != tt.wantReason {
+				t.Errorf("VerifyAccess() = %v, want reason %s", err, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestVerifyAccessWithAPIKey(t *testing.T) {
+	var gotKey, gotEmail, gotAuth string
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, body string) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}
+	mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		gotKey, gotEmail = r.Header.Get("X-Auth-Key"), r.Header.Get("X-Auth-Email")
+		gotAuth = r.Header.Get("Authorization")
+		writeJSON(w, `{"success":true,"errors":[],"messages":[],"result":{"id":"u"}}`)
+	})
+	mux.HandleFunc("GET /zones/zone-1", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, `{"success":true,"errors":[],"messages":[],"result":{"id":"zone-1"}}`)
+	})
+	mux.HandleFunc("GET /zones/zone-1/dns_records", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, `{"success":true,"errors":[],"messages":[],"result":[],"result_info":{}}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	t.Setenv("CLOUDFLARE_BASE_URL", srv.URL)
+	t.Setenv("CLOUDFLARE_API_TOKEN", "env-token")
+
+	c := NewClient("", "zone-1", WithAPIKey("admin@example.com", "global-key"), WithRetry(1, 0, 0))
+	if err := c.(Verifier).VerifyAccess(context.Background()); err != nil {
+		t.Fatalf("VerifyAccess() = %v", err)
+	}
+	if gotKey != "global-key" || gotEmail != "admin@example.com" {
+		t.Errorf("X-Auth-Key = %q, X-Auth-Email = %q", gotKey, gotEmail)
+	}
+	if gotAuth != "" {
+		t.Errorf("Authorization = %q, want it unset", gotAuth)
+	}
+}
@@ -0,0 +1,374 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ControllerConfig is the controller configuration file passed with --config.
+type ControllerConfig struct {
+	Target              TargetConfig   `yaml:"target"`
+	ZoneID              string         `yaml:"zoneID"`
+	RequeueInterval     time.Duration  `yaml:"requeueInterval"`
+	ResyncJitter        float64        `yaml:"resyncJitter"`
+	Queue               QueueConfig    `yaml:"queue"`
+	APIRateLimit        RateLimit      `yaml:"apiRateLimit"`
+	RecordCacheTTL      time.Duration  `yaml:"recordCacheTTL"`
+	AccessCheckInterval time.Duration  `yaml:"accessCheckInterval"`
+	Batch               BatchConfig    `yaml:"batch"`
+	ApplyConcurrency    int            `yaml:"applyConcurrency"`
+	DeletionGracePeriod time.Duration  `yaml:"deletionGracePeriod"`
+	Approval            ApprovalConfig `yaml:"approval"`
+	Records             RecordDefaults `yaml:"records"`
+	Credentials         Credentials    `yaml:"credentials"`
+	API                 APIConfig      `yaml:"api"`
+	Tracing             TracingConfig  `yaml:"tracing"`
+	Audit               AuditConfig    `yaml:"audit"`
+	Notifications       Notifications  `yaml:"notifications"`
+	History             HistoryConfig  `yaml:"history"`
+}
+
+// ApprovalConfig makes updates and deletes wait for the plan hash to be
+// approved on the source ConfigMap. Creates wait too unless AutoApproveCreates.
+type ApprovalConfig struct {
+	Required           bool `yaml:"required"`
+	AutoApproveCreates bool `yaml:"autoApproveCreates"`
+}
+
+// HistoryConfig keeps snapshots of the last Limit deleted records in the
+// ConfigMap ConfigMapName of the target namespace. A Limit of 0 disables it.
+type HistoryConfig struct {
+	ConfigMapName string `yaml:"configMapName"`
+	Limit         int    `yaml:"limit"`
+}
+
+// Notifications post applied plans, and reconciles failing FailureThreshold
+// times in a row, to Webhooks. Identical events within DedupWindow are sent
+// once, and a DedupWindow of 0 sends every event.
+type Notifications struct {
+	Webhooks         []WebhookConfig `yaml:"webhooks"`
+	FailureThreshold int             `yaml:"failureThreshold"`
+	DedupWindow      time.Duration   `yaml:"dedupWindow"`
+}
+
+// WebhookConfig is an endpoint given by URL or read from URLFile, such as a
+// mounted Secret. Format is "generic" or "slack", and Template optionally
+// renders the JSON payload from the event.
+type WebhookConfig struct {
+	URL      string `yaml:"url"`
+	URLFile  string `yaml:"urlFile"`
+	Format   string `yaml:"format"`
+	Template string `yaml:"template"`
+}
+
+// AuditConfig optionally appends audit events of record changes as JSON lines
+// to File. Events are always written to the "audit" logger.
+type AuditConfig struct {
+	File string `yaml:"file"`
+}
+
+// TracingConfig exports traces over OTLP/gRPC to Endpoint. Tracing is off
+// unless Endpoint or OTEL_EXPORTER_OTLP_ENDPOINT is set. SampleRatio is the
+// fraction of new traces kept.
+type TracingConfig struct {
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+// APIConfig controls how the Cloudflare API is reached. BaseURL points at a
+// Cloudflare-compatible API, ProxyURL overrides HTTPS_PROXY and CAFile adds a
+// PEM bundle to the trusted roots. A RequestTimeout of 0 disables it.
+type APIConfig struct {
+	BaseURL         string        `yaml:"baseURL"`
+	ProxyURL        string        `yaml:"proxyURL"`
+	CAFile          string        `yaml:"caFile"`
+	RequestTimeout  time.Duration `yaml:"requestTimeout"`
+	UserAgentSuffix string        `yaml:"userAgentSuffix"`
+}
+
+// Credentials point at files holding the API token and zone ID, such as a
+// mounted Secret. The files are watched and reloaded when they change.
+// AllowSecretRefs lets a ConfigMap use its own credentials Secret instead.
+// AuthMode is "token", or "apiKey" for a Global API Key and email read from
+// CLOUDFLARE_API_KEY and CLOUDFLARE_EMAIL.
+type Credentials struct {
+	AuthMode        string `yaml:"authMode"`
+	APITokenFile    string `yaml:"apiTokenFile"`
+	ZoneIDFile      string `yaml:"zoneIDFile"`
+	AllowSecretRefs bool   `yaml:"allowSecretRefs"`
+}
+
+// BatchConfig controls whether record changes go through the DNS batch endpoint
+// and how many changes are sent per request. Batching is off unless enabled.
+type BatchConfig struct {
+	Enabled bool `yaml:"enabled"`
+	Size    int  `yaml:"size"`
+}
+
+// RateLimit is the token bucket shared by every Cloudflare API call. A QPS of 0 disables it.
+type RateLimit struct {
+	QPS   float64 `yaml:"qps"`
+	Burst int     `yaml:"burst"`
+}
+
+// QueueConfig tunes how failed reconciles are retried. Failed items back off
+// exponentially from BaseDelay to MaxDelay, and all retries share a QPS/Burst bucket.
+type QueueConfig struct {
+	MaxConcurrentReconciles int           `yaml:"maxConcurrentReconciles"`
+	BaseDelay               time.Duration `yaml:"baseDelay"`
+	MaxDelay                time.Duration `yaml:"maxDelay"`
+	QPS                     float64       `yaml:"qps"`
+	Burst                   int           `yaml:"burst"`
+}
+
+// TargetConfig selects the ConfigMap and keys holding cloudflared configs.
+// LabelSelector additionally requires the ConfigMap to carry matching labels.
+type TargetConfig struct {
+	Name          string `yaml:"name"`
+	Namespace     string `yaml:"namespace"`
+	Key           string `yaml:"key"`
+	LabelSelector string `yaml:"labelSelector"`
+}
+
+// RecordDefaults apply to every record unless overridden per hostname.
+type RecordDefaults struct {
+	Proxied       *bool  `yaml:"proxied"`
+	TTL           int    `yaml:"ttl"`
+	CommentPrefix string `yaml:"commentPrefix"`
+}
+
+func DefaultControllerConfig() ControllerConfig {
+	proxied := true
+	return ControllerConfig{
+		Target: TargetConfig{
+			Name:      "cloudflared",
+			Namespace: "cloudflared",
+			Key:       "config.yaml",
+		},
+		RequeueInterval: 5 * time.Minute,
+		ResyncJitter:    0.1,
+		Queue: QueueConfig{
+			MaxConcurrentReconciles: 1,
+			BaseDelay:               5 * time.Millisecond,
+			MaxDelay:                1000 * time.Second,
+			QPS:                     10,
+			Burst:                   100,
+		},
+		// Cloudflare allows 1200 requests per 5 minutes per user.
+		APIRateLimit: RateLimit{
+			QPS:   4,
+			Burst: 10,
+		},
+		RecordCacheTTL:      time.Minute,
+		AccessCheckInterval: 5 * time.Minute,
+		Batch: BatchConfig{
+			Size: 200,
+		},
+		ApplyConcurrency: 4,
+		Records: RecordDefaults{
+			Proxied: &proxied,
+			TTL:     1,
+		},
+		Credentials: Credentials{
+			AuthMode: "token",
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+		},
+		Notifications: Notifications{
+			FailureThreshold: 3,
+			DedupWindow:      time.Hour,
+		},
+		History: HistoryConfig{
+			ConfigMapName: "cloudflared-dns-history",
+			Limit:         100,
+		},
+	}
+}
+
+// LoadControllerConfig reads path on top of DefaultControllerConfig.
+// Unknown fields are rejected so typos don't silently fall back to defaults.
+func LoadControllerConfig(path string) (ControllerConfig, error) {
+	cfg := DefaultControllerConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read controller config: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("failed to parse controller config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (c ControllerConfig) Validate() error {
+	var errs []error
+	if c.Target.Name == "" {
+		errs = append(errs, errors.New("target.name must not be empty"))
+	}
+	if c.Target.Namespace == "" {
+		errs = append(errs, errors.New("target.namespace must not be empty"))
+	}
+	if c.Target.Key == "" {
+		errs = append(errs, errors.New("target.key must not be empty"))
+	}
+	if _, err := labels.Parse(c.Target.LabelSelector); err != nil {
+		errs = append(errs, fmt.Errorf("target.labelSelector: %w", err))
+	}
+	if c.ZoneID == "" && c.Credentials.ZoneIDFile == "" {
+		errs = append(errs, errors.New("zoneID or credentials.zoneIDFile must be set"))
+	}
+	switch c.Credentials.AuthMode {
+	case "token":
+	case "apiKey":
+		if c.Credentials.APITokenFile != "" {
+			errs = append(errs, errors.New("credentials.apiTokenFile cannot be used with credentials.authMode apiKey"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("credentials.authMode must be token or apiKey, got %q", c.Credentials.AuthMode))
+	}
+	if c.RequeueInterval <= 0 {
+		errs = append(errs, errors.New("requeueInterval must be positive"))
+	}
+	if c.ResyncJitter < 0 || c.ResyncJitter > 1 {
+		errs = append(errs, fmt.Errorf("resyncJitter must be between 0 and 1, got %v", c.ResyncJitter))
+	}
+	if err := c.Queue.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.APIRateLimit.QPS < 0 || (c.APIRateLimit.QPS > 0 && c.APIRateLimit.Burst < 1) {
+		errs = append(errs, errors.New("apiRateLimit.qps must not be negative and apiRateLimit.burst must be positive"))
+	}
+	if c.RecordCacheTTL < 0 {
+		errs = append(errs, errors.New("recordCacheTTL must not be negative"))
+	}
+	if c.AccessCheckInterval < 0 {
+		errs = append(errs, errors.New("accessCheckInterval must not be negative"))
+	}
+	if c.Batch.Size < 1 {
+		errs = append(errs, fmt.Errorf("batch.size must be at least 1, got %d", c.Batch.Size))
+	}
+	if c.ApplyConcurrency < 1 {
+		errs = append(errs, fmt.Errorf("applyConcurrency must be at least 1, got %d", c.ApplyConcurrency))
+	}
+	if c.DeletionGracePeriod < 0 {
+		errs = append(errs, errors.New("deletionGracePeriod must not be negative"))
+	}
+	if err := c.API.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sampleRatio must be between 0 and 1, got %v", c.Tracing.SampleRatio))
+	}
+	if err := c.Notifications.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.History.Limit < 0 {
+		errs = append(errs, fmt.Errorf("history.limit must not be negative, got %d", c.History.Limit))
+	}
+	if c.History.Limit > 0 && (c.History.ConfigMapName == "" || c.History.ConfigMapName == c.Target.Name) {
+		errs = append(errs, errors.New("history.configMapName must be set and differ from target.name"))
+	}
+	if err := c.Records.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (n Notifications) Validate() error {
+	var errs []error
+	for i, hook := range n.Webhooks {
+		if (hook.URL == "") == (hook.URLFile == "") {
+			errs = append(errs, fmt.Errorf("notifications.webhooks[%d]: exactly one of url and urlFile must be set", i))
+		}
+		switch hook.Format {
+		case "", "generic", "slack":
+		default:
+			errs = append(errs, fmt.Errorf("notifications.webhooks[%d].format must be generic or slack, got %q", i, hook.Format))
+		}
+	}
+	if n.FailureThreshold < 1 {
+		errs = append(errs, fmt.Errorf("notifications.failureThreshold must be at least 1, got %d", n.FailureThreshold))
+	}
+	if n.DedupWindow < 0 {
+		errs = append(errs, errors.New("notifications.dedupWindow must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+func (q QueueConfig) Validate() error {
+	var errs []error
+	if q.MaxConcurrentReconciles < 1 {
+		errs = append(errs, errors.New("queue.maxConcurrentReconciles must be at least 1"))
+	}
+	if q.BaseDelay <= 0 || q.MaxDelay < q.BaseDelay {
+		errs = append(errs, errors.New("queue.baseDelay must be positive and not greater than queue.maxDelay"))
+	}
+	if q.QPS <= 0 || q.Burst < 1 {
+		errs = append(errs, errors.New("queue.qps and queue.burst must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+func (a APIConfig) Validate() error {
+	var errs []error
+	for _, field := range []struct{ name, value string }{
+		{"api.baseURL", a.BaseURL},
+		{"api.proxyURL", a.ProxyURL},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if u, err := url.Parse(field.value); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s must be an absolute URL, got %q", field.name, field.value))
+		}
+	}
+	if a.RequestTimeout < 0 {
+		errs = append(errs, errors.New("api.requestTimeout must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+func (d RecordDefaults) Validate() error {
+	if d.TTL != 1 && (d.TTL < 30 || d.TTL > 86400) {
+		return fmt.Errorf("records.ttl must be 1 (automatic) or between 30 and 86400, got %d", d.TTL)
+	}
+	if d.IsProxied() && d.TTL != 1 {
+		return fmt.Errorf("records.ttl must be 1 when records.proxied is true, got %d", d.TTL)
+	}
+	return nil
+}
+
+// IsProxied reports the default proxied setting, which is true when unset.
+func (d RecordDefaults) IsProxied() bool {
+	return d.Proxied == nil || *d.Proxied
+}
+
+// RecordTTL returns the default TTL, which is 1 (automatic) when unset.
+func (d RecordDefaults) RecordTTL() int {
+	if d.TTL == 0 {
+		return 1
+	}
+	return d.TTL
+}
+
+// Comment prepends CommentPrefix to comment.
+func (d RecordDefaults) Comment(comment string) string {
+	switch {
+	case d.CommentPrefix == "":
+		return comment
+	case comment == "":
+		return d.CommentPrefix
+	}
+	return d.CommentPrefix + " " + comment
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeControllerConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadControllerConfig(t *testing.T) {
+	path := writeControllerConfig(t, `target:
+  namespace: tunnels
+  key: "*.yaml"
+zoneID: zone-1
+requeueInterval: 10m
+records:
+  proxied: false
+  ttl: 300
+  commentPrefix: "[managed]"
+`)
+	cfg, err := LoadControllerConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if cfg.Target.Name != "cloudflared" {
+		t.Errorf("target.name = %q, want default", cfg.Target.Name)
+	}
+	if cfg.Target.Namespace != "tunnels" || cfg.Target.Key != "*.yaml" {
+		t.Errorf("target = %+v", cfg.Target)
+	}
+	if cfg.RequeueInterval != 10*time.Minute {
+		t.Errorf("requeueInterval = %v, want 10m", cfg.RequeueInterval)
+	}
+	if cfg.Records.IsProxied() || cfg.Records.RecordTTL() != 300 {
+		t.Errorf("records = %+v", cfg.Records)
+	}
+	if got := cfg.Records.Comment("api"); got != "[managed] api" {
+		t.Errorf("comment = %q", got)
+	}
+}
+
+func TestLoadControllerConfigUnknownField(t *testing.T) {
+	path := writeControllerConfig(t, "zoneId: zone-1\n")
+	if _, err := LoadControllerConfig(path); err == nil {
+		t.Fatal("expected error for unknown field")
+	}
+}
+
+func TestControllerConfigValidate(t *testing.T) {
+	cfg := DefaultControllerConfig()
+	cfg.Target.Key = ""
+	cfg.RequeueInterval = 0
+	cfg.Records.TTL = 300
+	cfg.ResyncJitter = 2
+	cfg.Queue.QPS = 0
+	cfg.Target.LabelSelector = "app in (cloudflared"
+	cfg.Credentials.AuthMode = "apiKey"
+	cfg.Credentials.APITokenFile = "/etc/cloudflare/api-token"
+	cfg.API.BaseURL = "localhost:8080"
+	cfg.Tracing.SampleRatio = 1.5
+	cfg.Notifications.Webhooks = []WebhookConfig{{Format: "teams"}}
+	cfg.History.Limit = -1
+	cfg.DeletionGracePeriod = -time.Minute
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"target.key", "target.labelSelector", "zoneID", "requeueInterval", "resyncJitter", "queue.qps", "records.ttl", "credentials.apiTokenFile", "api.baseURL", "tracing.sampleRatio", "notifications.webhooks[0]: exactly one", "notifications.webhooks[0].format", "history.limit", "deletionGracePeriod"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
@@ -1,22 +1,87 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultKeys are the filenames cloudflared itself looks for, in order of preference.
+var DefaultKeys = []string{"config.yaml", "config.yml", "config.json"}
+
 type CloudflaredConfig struct {
-	Tunnel  string        `yaml:"tunnel"`
-	Ingress []IngressRule `yaml:"ingress"`
+	Tunnel  string        `yaml:"tunnel" json:"tunnel"`
+	Ingress []IngressRule `yaml:"ingress" json:"ingress"`
 }
 
 type IngressRule struct {
-	Hostname string `yaml:"hostname,omitempty"`
-	Service  string `yaml:"service"`
+	Hostname string       `yaml:"hostname,omitempty" json:"hostname,omitempty"`
+	Service  string       `yaml:"service" json:"service"`
+	DNS      *DNSSettings `yaml:"x-dns,omitempty" json:"x-dns,omitempty"`
+}
+
+// DNSSettings overrides how the DNS record of a hostname is created.
+// Unset fields keep the controller defaults, which for Comment is the comment
+// prefix alone and for Tags is none.
+type DNSSettings struct {
+	Proxied *bool    `yaml:"proxied,omitempty" json:"proxied,omitempty"`
+	TTL     *int     `yaml:"ttl,omitempty" json:"ttl,omitempty"`
+	Comment *string  `yaml:"comment,omitempty" json:"comment,omitempty"`
+	Tags    []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+}
+
+// Merge returns s with every field set in override replaced.
+func (s DNSSettings) Merge(override DNSSettings) DNSSettings {
+	if override.Proxied != nil {
+		s.Proxied = override.Proxied
+	}
+	if override.TTL != nil {
+		s.TTL = override.TTL
+	}
+	if override.Comment != nil {
+		s.Comment = override.Comment
+	}
+	if override.Tags != nil {
+		s.Tags = override.Tags
+	}
+	return s
+}
+
+// ParseDNSOverrides decodes a hostname to DNSSettings map, as YAML or JSON.
+func ParseDNSOverrides(data string) (map[string]DNSSettings, error) {
+	overrides := map[string]DNSSettings{}
+	if err := yaml.Unmarshal([]byte(data), &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse DNS overrides: %w", err)
+	}
+	return overrides, nil
 }
 
+// Parse decodes a cloudflared config, treating input that starts with '{' as JSON.
 func Parse(data string) (*CloudflaredConfig, error) {
+	if strings.HasPrefix(strings.TrimSpace(data), "{") {
+		return ParseJSON(data)
+	}
+	return ParseYAML(data)
+}
+
+// ParseKey decodes the config stored under key, choosing the format from its extension.
+func ParseKey(key, data string) (*CloudflaredConfig, error) {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".json":
+		return ParseJSON(data)
+	case ".yaml", ".yml":
+		return ParseYAML(data)
+	}
+	return Parse(data)
+}
+
+func ParseYAML(data string) (*CloudflaredConfig, error) {
 	var cfg CloudflaredConfig
 	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse cloudflared config: %w", err)
@@ -24,6 +89,66 @@ func Parse(data string) (*CloudflaredConfig, error) {
 	return &cfg, nil
 }
 
+func ParseJSON(data string) (*CloudflaredConfig, error) {
+	var cfg CloudflaredConfig
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		var offset int64 = -1
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			offset = syntaxErr.Offset
+		case errors.As(err, &typeErr):
+			offset = typeErr.Offset
+		}
+		if offset >= 0 {
+			line, col := position(data, offset)
+			return nil, fmt.Errorf("failed to parse cloudflared config: line %d, column %d: %w", line, col, err)
+		}
+		return nil, fmt.Errorf("failed to parse cloudflared config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// position converts a byte offset reported by encoding/json into a 1-based line and column.
+func position(data string, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := []byte(data[:offset])
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - (bytes.LastIndexByte(before, '\n') + 1)
+	if col == 0 {
+		col = 1
+	}
+	return line, col
+}
+
+// FindKeys returns the keys in data matching any of patterns (literal keys or
+// path.Match globs), sorted. When nothing matches, the first of DefaultKeys
+// found in data is used.
+func FindKeys(data map[string]string, patterns []string) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		for _, pattern := range patterns {
+			if matched, err := path.Match(pattern, key); (err == nil && matched) || pattern == key {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		return keys
+	}
+	for _, key := range DefaultKeys {
+		if _, ok := data[key]; ok {
+			return []string{key}
+		}
+	}
+	return nil
+}
+
 func (c *CloudflaredConfig) Hostnames() []string {
 	hostnames := make([]string, 0, len(c.Ingress))
 	for _, rule := range c.Ingress {
@@ -34,6 +159,21 @@ func (c *CloudflaredConfig) Hostnames() []string {
 	return hostnames
 }
 
+// DNSSettings returns the x-dns settings of every hostname that declares them.
+func (c *CloudflaredConfig) DNSSettings() map[string]DNSSettings {
+	settings := make(map[string]DNSSettings)
+	for _, rule := range c.Ingress {
+		if rule.Hostname != "" && rule.DNS != nil {
+			settings[rule.Hostname] = *rule.DNS
+		}
+	}
+	return settings
+}
+
 func (c *CloudflaredConfig) TunnelTarget() string {
-	return fmt.Sprintf("%s.cfargotunnel.com", c.Tunnel)
+	return TunnelTarget(c.Tunnel)
+}
+
+func TunnelTarget(tunnel string) string {
+	return fmt.Sprintf("%s.cfargotunnel.com", tunnel)
 }
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testYAML = `tunnel: test-tunnel-id
+ingress:
+  - hostname: app.example.com
+    service: http://localhost:80
+  - service: http_status:404
+`
+
+const testJSON = `{
+  "tunnel": "test-tunnel-id",
+  "ingress": [
+    {"hostname": "app.example.com", "service": "http://localhost:80"},
+    {"service": "http_status:404"}
+  ]
+}`
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		data string
+	}{
+		{name: "yaml", key: "config.yaml", data: testYAML},
+		{name: "yml", key: "config.yml", data: testYAML},
+		{name: "json", key: "config.json", data: testJSON},
+		{name: "json without extension", key: "config", data: testJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseKey(tt.key, tt.data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.Tunnel != "test-tunnel-id" {
+				t.Errorf("tunnel = %q, want %q", cfg.Tunnel, "test-tunnel-id")
+			}
+			if got := cfg.Hostnames(); len(got) != 1 || got[0] != "app.example.com" {
+				t.Errorf("hostnames = %v, want [app.example.com]", got)
+			}
+		})
+	}
+}
+
+func TestParseJSONErrorPosition(t *testing.T) {
+	data := "{\n  \"tunnel\": \"id\",\n  \"ingress\": [,]\n}"
+	_, err := ParseJSON(data)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "line 3, column 15") {
+		t.Errorf("error %q does not contain position", err)
+	}
+}
+
+func TestFindKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     map[string]string
+		patterns []string
+		want     []string
+	}{
+		{
+			name:     "preferred",
+			data:     map[string]string{"tunnel.yaml": "", "config.yaml": ""},
+			patterns: []string{"tunnel.yaml"},
+			want:     []string{"tunnel.yaml"},
+		},
+		{
+			name:     "fallback yml",
+			data:     map[string]string{"config.yml": ""},
+			patterns: []string{"config.yaml"},
+			want:     []string{"config.yml"},
+		},
+		{
+			name:     "fallback json",
+			data:     map[string]string{"config.json": ""},
+			patterns: []string{"config.yaml"},
+			want:     []string{"config.json"},
+		},
+		{
+			name:     "list",
+			data:     map[string]string{"prod.yaml": "", "staging.yaml": "", "internal.yaml": ""},
+			patterns: []string{"staging.yaml", "prod.yaml"},
+			want:     []string{"prod.yaml", "staging.yaml"},
+		},
+		{
+			name:     "glob",
+			data:     map[string]string{"prod.yaml": "", "staging.yaml": "", "README.md": ""},
+			patterns: []string{"*.yaml"},
+			want:     []string{"prod.yaml", "staging.yaml"},
+		},
+		{
+			name:     "missing",
+			data:     map[string]string{"other.yaml": ""},
+			patterns: []string{"config.yaml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FindKeys(tt.data, tt.patterns)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("FindKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSSettings(t *testing.T) {
+	data := `tunnel: test-tunnel-id
+ingress:
+  - hostname: app.example.com
+    service: http://localhost:80
+    x-dns:
+      proxied: false
+      ttl: 300
+  - hostname: api.example.com
+    service: http://localhost:80
+  - service: http_status:404
+`
+	cfg, err := Parse(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	settings := cfg.DNSSettings()
+	if len(settings) != 1 {
+		t.Fatalf("settings = %v, want one entry", settings)
+	}
+
+	overrides, err := ParseDNSOverrides(`{"app.example.com": {"ttl": 600, "comment": "web"}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	merged := settings["app.example.com"].Merge(overrides["app.example.com"])
+	if merged.Proxied == nil || *merged.Proxied {
+		t.Errorf("proxied = %v, want false", merged.Proxied)
+	}
+	if merged.TTL == nil || *merged.TTL != 600 {
+		t.Errorf("ttl = %v, want 600", merged.TTL)
+	}
+	if merged.Comment == nil || *merged.Comment != "web" {
+		t.Errorf("comment = %v, want web", merged.Comment)
+	}
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+)
+
+const (
+	// pendingPlanAnnotation lists the hostnames of the changes waiting for
+	// approval, as JSON.
+	pendingPlanAnnotation = "cloudflared-dns-controller.seipan.github.io/pending-plan"
+
+	// pendingPlanHashAnnotation identifies the changes waiting for approval.
+	pendingPlanHashAnnotation = "cloudflared-dns-controller.seipan.github.io/pending-plan-hash"
+
+	// approvedPlanAnnotation is set by a human to the pending plan hash to let
+	// the controller apply it.
+	approvedPlanAnnotation = "cloudflared-dns-controller.seipan.github.io/approved-plan"
+)
+
+// gatePlan returns the part of plan that can be applied now. When
+// RequireApproval is set, updates, deletes and, unless AutoApproveCreates is
+// set, creates wait until approvedPlanAnnotation matches their hash, and are
+// recorded in the pending plan annotations meanwhile. It reports whether
+// changes are waiting and whether cm changed.
+func (r *CloudflaredDNSReconciler) gatePlan(
+	log logr.Logger, cm *corev1.ConfigMap, plan cloudflare.Plan,
+) (apply cloudflare.Plan, waiting, changed bool) {
+	if !r.RequireApproval {
+		return plan, false, false
+	}
+	gated := r.gatedChanges(plan)
+	if gated.IsEmpty() {
+		return plan, false, clearApproval(cm, false)
+	}
+	hash := planHash(gated)
+	if cm.Annotations[approvedPlanAnnotation] == hash {
+		log.Info("Applying approved plan", "hash", hash)
+		// An approval is used once, so the same changes need approving again later.
+		return plan, false, clearApproval(cm, true)
+	}
+
+	if r.AutoApproveCreates {
+		apply.Creates = plan.Creates
+	}
+	v, _ := json.Marshal(newAppliedPlan(gated))
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	if cm.Annotations[pendingPlanHashAnnotation] != hash || cm.Annotations[pendingPlanAnnotation] != string(v) {
+		log.Info("Plan is waiting for approval", "hash", hash, "changes", gated.Len())
+		cm.Annotations[pendingPlanAnnotation] = string(v)
+		cm.Annotations[pendingPlanHashAnnotation] = hash
+		changed = true
+	}
+	return apply, true, changed
+}
+
+// gatedChanges returns the changes of plan that need approval.
+func (r *CloudflaredDNSReconciler) gatedChanges(plan cloudflare.Plan) cloudflare.Plan {
+	gated := cloudflare.Plan{Updates: plan.Updates, Deletes: plan.Deletes}
+	if !r.AutoApproveCreates {
+		gated.Creates = plan.Creates
+	}
+	return gated
+}
+
+// clearApproval removes the pending plan annotations and, if approved, the
+// approval. It reports whether cm changed.
+func clearApproval(cm *corev1.ConfigMap, approved bool) bool {
+	keys := []string{pendingPlanAnnotation, pendingPlanHashAnnotation}
+	if approved {
+		keys = append(keys, approvedPlanAnnotation)
+	}
+	changed := false
+	for _, key := range keys {
+		if _, ok := cm.Annotations[key]; ok {
+			delete(cm.Annotations, key)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// planHash hashes the changes of plan independently of their order.
+func planHash(plan cloudflare.Plan) string {
+	sorted := func(recs []cloudflare.DNSRecord) []cloudflare.DNSRecord {
+		recs = slices.Clone(recs)
+		slices.SortFunc(recs, func(a, b cloudflare.DNSRecord) int {
+			return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+		})
+		return recs
+	}
+	data, _ := json.Marshal(cloudflare.Plan{
+		Creates: sorted(plan.Creates),
+		Updates: sorted(plan.Updates),
+		Deletes: sorted(plan.Deletes),
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
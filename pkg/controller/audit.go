@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/audit"
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+)
+
+type auditSourceKey struct{}
+
+// auditSource is the ConfigMap being reconciled and the records it started
+// from, used to fill in audit events.
+type auditSource struct {
+	source          string
+	resourceVersion string
+	existing        map[string]cloudflare.DNSRecord
+}
+
+func withAuditSource(ctx context.Context, cm *corev1.ConfigMap, existing []cloudflare.DNSRecord) context.Context {
+	byID := make(map[string]cloudflare.DNSRecord, len(existing))
+	for _, rec := range existing {
+		byID[rec.ID] = rec
+	}
+	return context.WithValue(ctx, auditSourceKey{}, auditSource{
+		source:          client.ObjectKeyFromObject(cm).String(),
+		resourceVersion: cm.ResourceVersion,
+		existing:        byID,
+	})
+}
+
+// audit records a change of one record. before is looked up by ID for updates.
+func (r *CloudflaredDNSReconciler) audit(ctx context.Context, action string, before, after *cloudflare.DNSRecord, err error) {
+	if r.Audit == nil {
+		return
+	}
+	src, _ := ctx.Value(auditSourceKey{}).(auditSource)
+	if before == nil && action == audit.ActionUpdate && after != nil {
+		if rec, ok := src.existing[after.ID]; ok {
+			before = &rec
+		}
+	}
+	ev := audit.Event{
+		Action:          action,
+		Result:          audit.ResultSuccess,
+		Source:          src.source,
+		ResourceVersion: src.resourceVersion,
+		ZoneID:          r.zoneID(ctx),
+		Before:          auditRecord(before),
+		After:           auditRecord(after),
+	}
+	if err != nil {
+		ev.Result, ev.Error = audit.ResultError, err.Error()
+	}
+	for _, rec := range []*cloudflare.DNSRecord{after, before} {
+		if rec != nil {
+			ev.Hostname = rec.Name
+			ev.Tunnel = strings.TrimSuffix(rec.Content, ".cfargotunnel.com")
+			break
+		}
+	}
+	r.Audit.Record(ev)
+}
+
+// auditPlan records the outcome of a plan applied as one batch. created holds
+// the records returned for plan.Creates.
+func (r *CloudflaredDNSReconciler) auditPlan(ctx context.Context, plan cloudflare.Plan, created []cloudflare.DNSRecord, err error) {
+	byName := make(map[string]cloudflare.DNSRecord, len(created))
+	for _, rec := range created {
+		byName[rec.Name] = rec
+	}
+	for _, rec := range plan.Deletes {
+		r.audit(ctx, audit.ActionDelete, &rec, nil, err)
+	}
+	for _, rec := range plan.Updates {
+		r.audit(ctx, audit.ActionUpdate, nil, &rec, err)
+	}
+	for _, rec := range plan.Creates {
+		if c, ok := byName[rec.Name]; ok {
+			rec = c
+		}
+		r.audit(ctx, audit.ActionCreate, nil, &rec, err)
+	}
+}
+
+func auditRecord(rec *cloudflare.DNSRecord) *audit.Record {
+	if rec == nil {
+		return nil
+	}
+	return &audit.Record{
+		ID:      rec.ID,
+		Name:    rec.Name,
+		Type:    rec.Type,
+		Content: rec.Content,
+		Proxied: rec.Proxied,
+		TTL:     rec.TTL,
+		Comment: rec.Comment,
+		Tags:    rec.Tags,
+	}
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/config"
+)
+
+// CacheOptions limits the manager's informers to the target namespace, and
+// ConfigMaps to the target name and label selector, so the controller neither
+// needs cluster-wide RBAC nor caches every ConfigMap in the cluster.
+func CacheOptions(target config.TargetConfig) (cache.Options, error) {
+	selector, err := labels.Parse(target.LabelSelector)
+	if err != nil {
+		return cache.Options{}, fmt.Errorf("invalid label selector %q: %w", target.LabelSelector, err)
+	}
+	return cache.Options{
+		DefaultNamespaces: map[string]cache.Config{
+			target.Namespace: {},
+		},
+		ByObject: map[client.Object]cache.ByObject{
+			&corev1.ConfigMap{}: {
+				Field: fields.OneTermEqualSelector("metadata.name", target.Name),
+				Label: selector,
+			},
+		},
+	}, nil
+}
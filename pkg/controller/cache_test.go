@@ -0,0 +1,38 @@
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var _ = Describe("CacheOptions", func() {
+	It("should only cache the target ConfigMap", func() {
+		opts, err := CacheOptions(config.TargetConfig{
+			Name:          testTargetName,
+			Namespace:     testTargetNamespace,
+			LabelSelector: "app=cloudflared",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opts.DefaultNamespaces).To(HaveLen(1))
+		Expect(opts.DefaultNamespaces).To(HaveKey(testTargetNamespace))
+
+		Expect(opts.ByObject).To(HaveLen(1))
+		for obj, byObject := range opts.ByObject {
+			Expect(obj).To(BeAssignableToTypeOf(&corev1.ConfigMap{}))
+			Expect(byObject.Field.Matches(fields.Set{"metadata.name": testTargetName})).To(BeTrue())
+			Expect(byObject.Field.Matches(fields.Set{"metadata.name": "other"})).To(BeFalse())
+			Expect(byObject.Label.Matches(labels.Set{"app": "cloudflared"})).To(BeTrue())
+			Expect(byObject.Label.Matches(labels.Set{})).To(BeFalse())
+		}
+	})
+
+	It("should reject an invalid label selector", func() {
+		_, err := CacheOptions(config.TargetConfig{Name: testTargetName, Namespace: testTargetNamespace, LabelSelector: "a in ("})
+		Expect(err).To(HaveOccurred())
+	})
+})
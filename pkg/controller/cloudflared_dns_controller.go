@@ -2,33 +2,122 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/seipan/cloudflared-dns-controller/pkg/audit"
 	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
 	"github.com/seipan/cloudflared-dns-controller/pkg/config"
+	"github.com/seipan/cloudflared-dns-controller/pkg/credentials"
+	"github.com/seipan/cloudflared-dns-controller/pkg/history"
+	"github.com/seipan/cloudflared-dns-controller/pkg/metrics"
+	"github.com/seipan/cloudflared-dns-controller/pkg/notify"
+	"github.com/seipan/cloudflared-dns-controller/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-const finalizerName = "cloudflared-dns-controller.seipan.github.io/finalizer"
+const (
+	finalizerName = "cloudflared-dns-controller.seipan.github.io/finalizer"
+
+	// managedKeysAnnotation records which ConfigMap keys the controller has
+	// synced and the tunnel each one pointed at, as a JSON object.
+	managedKeysAnnotation = "cloudflared-dns-controller.seipan.github.io/managed-keys"
+
+	// dnsOverridesAnnotation maps hostnames to config.DNSSettings (YAML or JSON).
+	// It takes precedence over x-dns settings on the ingress rules. A comment or
+	// tags set on neither are cleared from the record.
+	dnsOverridesAnnotation = "cloudflared-dns-controller.seipan.github.io/dns-overrides"
+)
 
 type CloudflaredDNSReconciler struct {
 	client.Client
 	Scheme     *runtime.Scheme
 	Cloudflare cloudflare.Client
+	ZoneID     string // labels metrics and records when Cloudflare does not know its zone
+	// Clients holds the clients of ConfigMaps that reference their own credentials Secret.
+	Clients *credentials.Pool
 
 	TargetName      string // ex "cloudflared"
 	TargetNamespace string // ex "cloudflared"
-	TargetKey       string // ex "config.yaml"
+	TargetKey       string // ex "config.yaml" or "prod.yaml,staging.yaml" or "*.yaml"
+
+	Defaults         config.RecordDefaults
+	RequeueInterval  time.Duration // defaults to 5 minutes
+	ResyncJitter     float64       // ex 0.1 spreads resyncs over RequeueInterval to 1.1x RequeueInterval
+	BatchChanges     bool          // apply plans through the DNS batch endpoint
+	ApplyConcurrency int           // record calls run at once when not batching, defaults to 1
+	// RequireApproval holds back updates and deletes until the plan hash is
+	// approved through an annotation, as are creates unless AutoApproveCreates.
+	RequireApproval    bool
+	AutoApproveCreates bool
+	// DeletionGracePeriod is how long a hostname must be absent from the ingress
+	// before its record is deleted. 0 deletes it on the next reconcile.
+	DeletionGracePeriod time.Duration
+	// Audit records every record change, nil disables it.
+	Audit *audit.Logger
+	// Notifier reports applied plans and persistent failures, nil disables it.
+	Notifier *notify.Notifier
+	// History keeps snapshots of deleted records for restores, nil disables it.
+	History *history.Store
+
+	// lastRefresh holds when each ConfigMap last listed records bypassing the cache.
+	lastRefresh sync.Map
+}
+
+// source is one cloudflared config read from a key of the target ConfigMap.
+type source struct {
+	key string
+	cfg *config.CloudflaredConfig
 }
 
 func (r *CloudflaredDNSReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Reconcile",
+		trace.WithAttributes(attribute.String("source", req.NamespacedName.String())))
+	defer span.End()
+	if pinner, ok := r.Cloudflare.(cloudflare.Pinner); ok {
+		// Finish on the current client even if credentials are rotated meanwhile.
+		ctx = pinner.Pin(ctx)
+	}
+	result, err := r.reconcile(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		r.Notifier.Failed(req.NamespacedName.String(), err)
+	} else {
+		r.Notifier.Succeeded(req.NamespacedName.String())
+	}
+	if retryAfter, ok := cloudflare.RetryAfter(err); ok {
+		ctrl.LoggerFrom(ctx).Info("Cloudflare API rate limited, requeueing", "retryAfter", retryAfter, "reason", err)
+		return ctrl.Result{RequeueAfter: retryAfter}, nil
+	}
+	return result, err
+}
+
+func (r *CloudflaredDNSReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := ctrl.LoggerFrom(ctx)
 	cm := &corev1.ConfigMap{}
 	if err := r.Get(ctx, req.NamespacedName, cm); err != nil {
@@ -36,9 +125,24 @@ func (r *CloudflaredDNSReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	}
 
 	if !cm.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(cm, finalizerName) {
+			return ctrl.Result{}, nil
+		}
+		ctx, err := r.withDeletionClient(ctx, cm)
+		if apierrors.IsNotFound(err) || (err != nil && r.Clients == nil) {
+			return r.blockDeletion(ctx, log, cm, err)
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
 		return r.handleDeletion(ctx, log, cm)
 	}
 
+	ctx, err := r.withSourceClient(ctx, cm)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if !controllerutil.ContainsFinalizer(cm, finalizerName) {
 		controllerutil.AddFinalizer(cm, finalizerName)
 		if err := r.Update(ctx, cm); err != nil {
@@ -48,67 +152,200 @@ func (r *CloudflaredDNSReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		log.Info("Finalizer added to ConfigMap")
 	}
 
-	data, ok := cm.Data[r.TargetKey]
-	if !ok {
+	managed := managedKeys(cm)
+	keys := config.FindKeys(cm.Data, r.targetKeys())
+	if len(keys) == 0 && len(managed) == 0 {
 		log.Info("ConfigMap does not contain target key", "key", r.TargetKey)
 		return ctrl.Result{}, nil
 	}
-	cfg, err := config.Parse(data)
+	sources, err := parseSources(cm, keys)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	overrides, err := dnsOverrides(cm)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	existingRecords, err := r.listRecords(ctx, req.NamespacedName)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
-	toCreate, toDelete, err := r.diff(ctx, cfg)
+	ctx = withAuditSource(ctx, cm, existingRecords)
+	restored, restoreChanged, err := r.restoredRecords(ctx, log, cm, sources, overrides)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	log.Info("Create DNS record count", "count", len(toCreate))
-	log.Info("Delete DNS record count", "count", len(toDelete))
+	var plan cloudflare.Plan
+	for _, tunnel := range tunnels(sources) {
+		desired := append(r.desiredRecords(sources, tunnel, overrides), restored[tunnel]...)
+		toCreate, toUpdate, toDelete := r.diff(existingRecords, tunnel, desired)
 
-	tunnelTarget := cfg.TunnelTarget()
-	for _, hostname := range toCreate {
-		log.Info("Creating DNS record", "hostname", hostname, "target", tunnelTarget)
-		rec := cloudflare.DNSRecord{
-			Name:    hostname,
-			Type:    "CNAME",
-			Content: tunnelTarget,
-			Proxied: true,
-			TTL:     1,
-		}
-		if err := r.Cloudflare.CreateDNSRecord(ctx, rec); err != nil {
+		log.Info("Create DNS record count", "tunnel", tunnel, "count", len(toCreate))
+		log.Info("Update DNS record count", "tunnel", tunnel, "count", len(toUpdate))
+		log.Info("Delete DNS record count", "tunnel", tunnel, "count", len(toDelete))
+
+		plan.Creates = append(plan.Creates, toCreate...)
+		plan.Updates = append(plan.Updates, toUpdate...)
+		plan.Deletes = append(plan.Deletes, toDelete...)
+	}
+	plan.Deletes = append(plan.Deletes, r.removedKeyRecords(log, existingRecords, managed, sources)...)
+	plan = mergeMoves(log, plan)
+	var pending map[string]time.Time
+	var nextDeletion time.Duration
+	plan.Deletes, pending, nextDeletion = r.deferDeletions(log, plan.Deletes, pendingDeletions(cm), time.Now().UTC().Truncate(time.Second))
+	apply, waiting, approvalChanged := r.gatePlan(log, cm, plan)
+
+	source := req.NamespacedName.String()
+	tracePlan(ctx, tunnels(sources), plan)
+	setPendingChanges(source, plan)
+	if err := r.applyPlan(ctx, log, apply); err != nil {
+		return ctrl.Result{}, err
+	}
+	if waiting {
+		// Keep the managed keys and desired hash, so the plan is computed again once approved.
+		setPendingChanges(source, r.gatedChanges(plan))
+		r.notifyPlan(ctx, source, tunnels(sources), apply)
+		pendingChanged, err := setPendingDeletions(cm, pending)
+		if err != nil {
 			return ctrl.Result{}, err
 		}
+		if approvalChanged || pendingChanged {
+			if err := r.Update(ctx, cm); err != nil {
+				log.Error(err, "unable to record pending plan on ConfigMap")
+				return ctrl.Result{}, err
+			}
+		}
+		setPendingDeletionMetrics(source, pending)
+		return ctrl.Result{RequeueAfter: r.requeueInterval()}, nil
 	}
+	setPendingChanges(source, cloudflare.Plan{})
+	r.notifyPlan(ctx, source, tunnels(sources), plan)
 
-	for _, rec := range toDelete {
-		log.Info("Deleting DNS record", "hostname", rec.Name)
-		if err := r.Cloudflare.DeleteDNSRecord(ctx, rec.ID); err != nil {
+	current := make(map[string]string, len(sources))
+	for _, src := range sources {
+		current[src.key] = src.cfg.Tunnel
+	}
+	changed := !maps.Equal(current, managed)
+	if changed {
+		if err := setManagedKeys(cm, current); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	stateChanged, err := setState(cm, r.hashDesiredState(cm, sources, overrides), plan)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	pendingChanged, err := setPendingDeletions(cm, pending)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if changed || stateChanged || restoreChanged || pendingChanged || approvalChanged {
+		if err := r.Update(ctx, cm); err != nil {
+			log.Error(err, "unable to record sync state on ConfigMap")
 			return ctrl.Result{}, err
 		}
 	}
-	return ctrl.Result{RequeueAfter: 5 * time.Minute}, nil
+
+	metrics.ManagedRecords.DeletePartialMatch(prometheus.Labels{"source": source})
+	for _, tunnel := range tunnels(sources) {
+		metrics.ManagedRecords.WithLabelValues(r.zoneID(ctx), tunnel, source).
+			Set(float64(len(r.desiredRecords(sources, tunnel, overrides))))
+	}
+	setPendingDeletionMetrics(source, pending)
+	metrics.LastSuccessfulSync.WithLabelValues(source).SetToCurrentTime()
+	requeueAfter := r.requeueInterval()
+	if nextDeletion > 0 && nextDeletion < requeueAfter {
+		requeueAfter = nextDeletion
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
-func (r *CloudflaredDNSReconciler) diff(
-	ctx context.Context, cfg *config.CloudflaredConfig,
-) (toCreate []string, toDelete []cloudflare.DNSRecord, err error) {
-	existingRecords, err := r.Cloudflare.ListDNSRecords(ctx)
+func (r *CloudflaredDNSReconciler) requeueInterval() time.Duration {
+	if r.ResyncJitter > 0 {
+		return wait.Jitter(r.baseRequeueInterval(), r.ResyncJitter)
+	}
+	return r.baseRequeueInterval()
+}
+
+func (r *CloudflaredDNSReconciler) baseRequeueInterval() time.Duration {
+	if r.RequeueInterval <= 0 {
+		return 5 * time.Minute
+	}
+	return r.RequeueInterval
+}
+
+// listRecords lists the zone's records, possibly from the record cache. Once per
+// requeue interval for each ConfigMap the cache is bypassed, so periodic resyncs
+// detect drift made outside the controller.
+func (r *CloudflaredDNSReconciler) listRecords(
+	ctx context.Context, key types.NamespacedName,
+) ([]cloudflare.DNSRecord, error) {
+	last, found := r.lastRefresh.Load(key)
+	if found && time.Since(last.(time.Time)) < r.baseRequeueInterval() {
+		return r.cloudflareClient(ctx).ListDNSRecords(ctx)
+	}
+	records, err := r.refreshRecords(ctx)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	r.lastRefresh.Store(key, time.Now())
+	return records, nil
+}
+
+func (r *CloudflaredDNSReconciler) refreshRecords(ctx context.Context) ([]cloudflare.DNSRecord, error) {
+	if refresher, ok := r.cloudflareClient(ctx).(cloudflare.Refresher); ok {
+		return refresher.RefreshDNSRecords(ctx)
 	}
+	return r.cloudflareClient(ctx).ListDNSRecords(ctx)
+}
+
+// removedKeyRecords returns the records of tunnels whose key has been removed
+// from the ConfigMap, unless another key still points at the same tunnel.
+func (r *CloudflaredDNSReconciler) removedKeyRecords(
+	log logr.Logger, existingRecords []cloudflare.DNSRecord, managed map[string]string, sources []source,
+) []cloudflare.DNSRecord {
+	inUse := make(map[string]struct{}, len(sources))
+	for _, src := range sources {
+		inUse[src.cfg.Tunnel] = struct{}{}
+	}
+	var toDelete []cloudflare.DNSRecord
+	for key, tunnel := range managed {
+		if _, found := inUse[tunnel]; found {
+			continue
+		}
+		for _, rec := range existingRecords {
+			if r.Cloudflare.IsTunnelRecord(rec, tunnel) {
+				log.Info("Deleting DNS record due to key removal", "key", key, "hostname", rec.Name)
+				toDelete = append(toDelete, rec)
+			}
+		}
+	}
+	return toDelete
+}
 
+func (r *CloudflaredDNSReconciler) diff(
+	existingRecords []cloudflare.DNSRecord, tunnel string, desired []cloudflare.DNSRecord,
+) (toCreate, toUpdate, toDelete []cloudflare.DNSRecord) {
 	existingMap := make(map[string]cloudflare.DNSRecord)
 	for _, rec := range existingRecords {
-		if r.Cloudflare.IsTunnelRecord(rec, cfg.Tunnel) {
+		if r.Cloudflare.IsTunnelRecord(rec, tunnel) {
 			existingMap[rec.Name] = rec
 		}
 	}
 
 	desiredHostnames := make(map[string]struct{})
-	for _, hostname := range cfg.Hostnames() {
-		desiredHostnames[hostname] = struct{}{}
-		if _, found := existingMap[hostname]; !found {
-			toCreate = append(toCreate, hostname)
+	for _, rec := range desired {
+		desiredHostnames[rec.Name] = struct{}{}
+		existing, found := existingMap[rec.Name]
+		if !found {
+			toCreate = append(toCreate, rec)
+			continue
+		}
+		if !recordSettingsEqual(existing, rec) {
+			rec.ID = existing.ID
+			toUpdate = append(toUpdate, rec)
 		}
 	}
 
@@ -118,7 +355,7 @@ func (r *CloudflaredDNSReconciler) diff(
 		}
 	}
 
-	return toCreate, toDelete, nil
+	return toCreate, toUpdate, toDelete
 }
 
 func (r *CloudflaredDNSReconciler) handleDeletion(
@@ -127,30 +364,51 @@ func (r *CloudflaredDNSReconciler) handleDeletion(
 	if !controllerutil.ContainsFinalizer(cm, finalizerName) {
 		return ctrl.Result{}, nil
 	}
-	data, ok := cm.Data[r.TargetKey]
-	if ok {
-		cfg, err := config.Parse(data)
+	managed := managedKeys(cm)
+	keys := config.FindKeys(cm.Data, r.targetKeys())
+	if len(keys) > 0 || len(managed) > 0 {
+		sources, err := parseSources(cm, keys)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
-		existingRecords, err := r.Cloudflare.ListDNSRecords(ctx)
+		existingRecords, err := r.refreshRecords(ctx)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
-		existingMap := make(map[string]cloudflare.DNSRecord)
-		for _, rec := range existingRecords {
-			if r.Cloudflare.IsTunnelRecord(rec, cfg.Tunnel) {
-				existingMap[rec.Name] = rec
+		ctx = withAuditSource(ctx, cm, existingRecords)
+
+		var plan cloudflare.Plan
+		for _, tunnel := range tunnels(sources) {
+			existingMap := make(map[string]cloudflare.DNSRecord)
+			for _, rec := range existingRecords {
+				if r.Cloudflare.IsTunnelRecord(rec, tunnel) {
+					existingMap[rec.Name] = rec
+				}
+			}
+
+			for _, desired := range r.desiredRecords(sources, tunnel, nil) {
+				if rec, found := existingMap[desired.Name]; found {
+					log.Info("Deleting DNS record due to ConfigMap deletion", "hostname", rec.Name)
+					plan.Deletes = append(plan.Deletes, rec)
+				}
 			}
 		}
+		plan.Deletes = append(plan.Deletes, r.removedKeyRecords(log, existingRecords, managed, sources)...)
 
-		for _, hostname := range cfg.Hostnames() {
-			if rec, found := existingMap[hostname]; found {
-				log.Info("Deleting DNS record due to ConfigMap deletion", "hostname", hostname)
-				if err := r.Cloudflare.DeleteDNSRecord(ctx, rec.ID); err != nil {
+		tracePlan(ctx, tunnels(sources), plan)
+		apply, waiting, approvalChanged := r.gatePlan(log, cm, plan)
+		if err := r.applyPlan(ctx, log, apply); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.notifyPlan(ctx, client.ObjectKeyFromObject(cm).String(), tunnels(sources), apply)
+		if waiting {
+			if approvalChanged {
+				if err := r.Update(ctx, cm); err != nil {
+					log.Error(err, "unable to record pending plan on ConfigMap")
 					return ctrl.Result{}, err
 				}
 			}
+			return ctrl.Result{RequeueAfter: r.requeueInterval()}, nil
 		}
 	}
 
@@ -160,15 +418,165 @@ func (r *CloudflaredDNSReconciler) handleDeletion(
 		return ctrl.Result{}, err
 	}
 	log.Info("Finalizer removed from ConfigMap")
+	r.lastRefresh.Delete(client.ObjectKeyFromObject(cm))
+	if r.Clients != nil {
+		r.Clients.Forget(client.ObjectKeyFromObject(cm).String())
+	}
+	metrics.DeleteSource(client.ObjectKeyFromObject(cm).String())
 	return ctrl.Result{}, nil
 }
 
-func (r *CloudflaredDNSReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.ConfigMap{}).
-		WithEventFilter(predicate.NewPredicateFuncs(func(obj client.Object) bool {
-			return obj.GetName() == r.TargetName &&
-				obj.GetNamespace() == r.TargetNamespace
-		})).
-		Complete(r)
+// targetKeys splits TargetKey into its comma-separated keys or globs.
+func (r *CloudflaredDNSReconciler) targetKeys() []string {
+	var keys []string
+	for key := range strings.SplitSeq(r.TargetKey, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func parseSources(cm *corev1.ConfigMap, keys []string) ([]source, error) {
+	sources := make([]source, 0, len(keys))
+	for _, key := range keys {
+		cfg, err := config.ParseKey(key, cm.Data[key])
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key, err)
+		}
+		sources = append(sources, source{key: key, cfg: cfg})
+	}
+	return sources, nil
+}
+
+// tunnels returns the distinct tunnels referenced by sources, in key order.
+func tunnels(sources []source) []string {
+	var result []string
+	seen := make(map[string]struct{})
+	for _, src := range sources {
+		if _, found := seen[src.cfg.Tunnel]; found {
+			continue
+		}
+		seen[src.cfg.Tunnel] = struct{}{}
+		result = append(result, src.cfg.Tunnel)
+	}
+	return result
+}
+
+// desiredRecords builds the records every source routed through tunnel asks for,
+// applying x-dns settings and then the annotation overrides on top of r.Defaults.
+func (r *CloudflaredDNSReconciler) desiredRecords(
+	sources []source, tunnel string, overrides map[string]config.DNSSettings,
+) []cloudflare.DNSRecord {
+	var records []cloudflare.DNSRecord
+	seen := make(map[string]struct{})
+	for _, src := range sources {
+		if src.cfg.Tunnel != tunnel {
+			continue
+		}
+		ruleSettings := src.cfg.DNSSettings()
+		for _, hostname := range src.cfg.Hostnames() {
+			if _, found := seen[hostname]; found {
+				continue
+			}
+			seen[hostname] = struct{}{}
+
+			settings := ruleSettings[hostname].Merge(overrides[hostname])
+			rec := cloudflare.DNSRecord{
+				Name:    hostname,
+				Type:    "CNAME",
+				Content: config.TunnelTarget(tunnel),
+				Proxied: r.Defaults.IsProxied(),
+				TTL:     r.Defaults.RecordTTL(),
+				Comment: r.Defaults.Comment(""),
+				Tags:    settings.Tags,
+			}
+			if settings.Proxied != nil {
+				rec.Proxied = *settings.Proxied
+			}
+			if settings.TTL != nil {
+				rec.TTL = *settings.TTL
+			}
+			if rec.Proxied {
+				// Proxied records always report TTL 1 (automatic).
+				rec.TTL = 1
+			}
+			if settings.Comment != nil {
+				rec.Comment = r.Defaults.Comment(*settings.Comment)
+			}
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+// recordSettingsEqual reports whether the overridable settings of two records match.
+func recordSettingsEqual(a, b cloudflare.DNSRecord) bool {
+	aTags, bTags := slices.Clone(a.Tags), slices.Clone(b.Tags)
+	slices.Sort(aTags)
+	slices.Sort(bTags)
+	return a.Proxied == b.Proxied &&
+		a.TTL == b.TTL &&
+		a.Comment == b.Comment &&
+		slices.Equal(aTags, bTags)
+}
+
+func dnsOverrides(cm *corev1.ConfigMap) (map[string]config.DNSSettings, error) {
+	v, ok := cm.Annotations[dnsOverridesAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	overrides, err := config.ParseDNSOverrides(v)
+	if err != nil {
+		return nil, fmt.Errorf("annotation %s: %w", dnsOverridesAnnotation, err)
+	}
+	return overrides, nil
+}
+
+func managedKeys(cm *corev1.ConfigMap) map[string]string {
+	managed := map[string]string{}
+	if v, ok := cm.Annotations[managedKeysAnnotation]; ok {
+		_ = json.Unmarshal([]byte(v), &managed)
+	}
+	return managed
+}
+
+func setManagedKeys(cm *corev1.ConfigMap, managed map[string]string) error {
+	v, err := json.Marshal(managed)
+	if err != nil {
+		return err
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[managedKeysAnnotation] = string(v)
+	return nil
+}
+
+func (r *CloudflaredDNSReconciler) SetupWithManager(mgr ctrl.Manager, opts SetupOptions) error {
+	rateLimiter := workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]()
+	if !opts.RateLimiter.isZero() {
+		rateLimiter = NewRateLimiter(opts.RateLimiter)
+	}
+	controllerOpts := controller.TypedOptions[reconcile.Request]{
+		MaxConcurrentReconciles: opts.MaxConcurrentReconciles,
+		RateLimiter: &loggingRateLimiter{
+			TypedRateLimiter: rateLimiter,
+			log:              mgr.GetLogger().WithName("ratelimiter"),
+		},
+	}
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.ConfigMap{}, builder.WithPredicates(
+			predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return obj.GetName() == r.TargetName &&
+					obj.GetNamespace() == r.TargetNamespace
+			}),
+			r.contentChangedPredicate(),
+		)).
+		WithOptions(controllerOpts)
+	if r.Clients != nil {
+		// Watching Secrets needs RBAC on them, so only do it when sources may reference one.
+		b = b.Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.secretToConfigMap))
+	}
+	return b.Complete(r)
 }
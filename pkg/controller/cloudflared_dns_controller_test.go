@@ -1,20 +1,43 @@
 package controller
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/seipan/cloudflared-dns-controller/pkg/audit"
 	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+	"github.com/seipan/cloudflared-dns-controller/pkg/config"
+	"github.com/seipan/cloudflared-dns-controller/pkg/credentials"
+	"github.com/seipan/cloudflared-dns-controller/pkg/history"
+	"github.com/seipan/cloudflared-dns-controller/pkg/metrics"
+	"github.com/seipan/cloudflared-dns-controller/pkg/notify"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
 const (
@@ -61,6 +84,27 @@ func newConfigMap(data map[string]string) *corev1.ConfigMap {
 	}
 }
 
+// auditTo points the reconciler's audit logger at a file and returns a func
+// reading the "hostname action/result" of every event written so far.
+func auditTo(reconciler *CloudflaredDNSReconciler) func() []string {
+	path := filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+	auditLogger, err := audit.New(logr.Discard(), path)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(auditLogger.Close)
+	reconciler.Audit = auditLogger
+	return func() []string {
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		var events []string
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var ev audit.Event
+			Expect(json.Unmarshal([]byte(line), &ev)).To(Succeed())
+			events = append(events, fmt.Sprintf("%s %s/%s", ev.Hostname, ev.Action, ev.Result))
+		}
+		return events
+	}
+}
+
 var _ = Describe("CloudflaredDNS Controller", func() {
 	var (
 		fakeCF     *fakeCloudflareClient
@@ -112,6 +156,19 @@ var _ = Describe("CloudflaredDNS Controller", func() {
 			Expect(fakeCF.deletedIDs).To(BeEmpty())
 		})
 
+		It("should jitter the resync interval", func() {
+			reconciler.RequeueInterval = time.Minute
+			reconciler.ResyncJitter = 0.5
+
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">=", time.Minute))
+			Expect(result.RequeueAfter).To(BeNumerically("<=", 90*time.Second))
+		})
+
 		It("should only create DNS records for new hostnames", func() {
 			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
 			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
@@ -152,8 +209,8 @@ var _ = Describe("CloudflaredDNS Controller", func() {
 			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
 
 			fakeCF.records = []cloudflare.DNSRecord{
-				{ID: "rec-1", Name: "app.example.com", Type: "CNAME", Content: tunnelTarget()},
-				{ID: "rec-2", Name: "api.example.com", Type: "CNAME", Content: tunnelTarget()},
+				{ID: "rec-1", Name: "app.example.com", Type: "CNAME", Content: tunnelTarget(), Proxied: true, TTL: 1},
+				{ID: "rec-2", Name: "api.example.com", Type: "CNAME", Content: tunnelTarget(), Proxied: true, TTL: 1},
 			}
 
 			result, err := reconciler.Reconcile(ctx, req)
@@ -161,6 +218,7 @@ var _ = Describe("CloudflaredDNS Controller", func() {
 			Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
 
 			Expect(fakeCF.createdRecords).To(BeEmpty())
+			Expect(fakeCF.updatedRecords).To(BeEmpty())
 			Expect(fakeCF.deletedIDs).To(BeEmpty())
 		})
 
@@ -192,6 +250,24 @@ var _ = Describe("CloudflaredDNS Controller", func() {
 			Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
 		})
 
+		It("should fall back to config.json when target key is missing", func() {
+			cm := newConfigMap(map[string]string{"config.json": `{
+  "tunnel": "test-tunnel-id",
+  "ingress": [
+    {"hostname": "app.example.com", "service": "http://localhost:80"},
+    {"service": "http_status:404"}
+  ]
+}`})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCF.createdRecords).To(HaveLen(1))
+			Expect(fakeCF.createdRecords[0].Name).To(Equal("app.example.com"))
+			Expect(fakeCF.createdRecords[0].Content).To(Equal(tunnelTarget()))
+		})
+
 		It("should do nothing when target key is missing", func() {
 			cm := newConfigMap(map[string]string{"other.yaml": "dummy"})
 			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
@@ -205,6 +281,847 @@ var _ = Describe("CloudflaredDNS Controller", func() {
 		})
 	})
 
+	Context("DNS overrides", func() {
+		const overridesYAML = `tunnel: test-tunnel-id
+ingress:
+  - hostname: app.example.com
+    service: http://localhost:80
+    x-dns:
+      proxied: false
+      ttl: 300
+      comment: managed by cloudflared-dns-controller
+      tags: ["team:web"]
+  - hostname: api.example.com
+    service: http://localhost:80
+  - service: http_status:404
+`
+
+		It("should apply x-dns settings on create", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: overridesYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCF.createdRecords).To(HaveLen(2))
+			Expect(fakeCF.createdRecords[0].Proxied).To(BeFalse())
+			Expect(fakeCF.createdRecords[0].TTL).To(Equal(300))
+			Expect(fakeCF.createdRecords[0].Comment).To(Equal("managed by cloudflared-dns-controller"))
+			Expect(fakeCF.createdRecords[0].Tags).To(ConsistOf("team:web"))
+			Expect(fakeCF.createdRecords[1].Proxied).To(BeTrue())
+			Expect(fakeCF.createdRecords[1].TTL).To(Equal(1))
+		})
+
+		It("should let the annotation override x-dns settings", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: overridesYAML})
+			cm.Annotations = map[string]string{
+				dnsOverridesAnnotation: `{"app.example.com": {"ttl": 600}, "api.example.com": {"comment": "api"}}`,
+			}
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCF.createdRecords).To(HaveLen(2))
+			Expect(fakeCF.createdRecords[0].Proxied).To(BeFalse())
+			Expect(fakeCF.createdRecords[0].TTL).To(Equal(600))
+			Expect(fakeCF.createdRecords[1].Comment).To(Equal("api"))
+		})
+
+		It("should apply the reconciler defaults", func() {
+			proxied := false
+			reconciler.Defaults = config.RecordDefaults{Proxied: &proxied, TTL: 120, CommentPrefix: "[managed]"}
+			reconciler.RequeueInterval = time.Minute
+
+			cm := newConfigMap(map[string]string{testTargetKey: overridesYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+
+			Expect(fakeCF.createdRecords).To(HaveLen(2))
+			Expect(fakeCF.createdRecords[0].Comment).To(Equal("[managed] managed by cloudflared-dns-controller"))
+			Expect(fakeCF.createdRecords[1].Proxied).To(BeFalse())
+			Expect(fakeCF.createdRecords[1].TTL).To(Equal(120))
+			Expect(fakeCF.createdRecords[1].Comment).To(Equal("[managed]"))
+		})
+
+		It("should correct drifted records", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: overridesYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			fakeCF.records = []cloudflare.DNSRecord{
+				{ID: "rec-1", Name: "app.example.com", Type: "CNAME", Content: tunnelTarget(), Proxied: true, TTL: 1},
+				{ID: "rec-2", Name: "api.example.com", Type: "CNAME", Content: tunnelTarget(), Proxied: true, TTL: 1},
+			}
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCF.createdRecords).To(BeEmpty())
+			Expect(fakeCF.deletedIDs).To(BeEmpty())
+			Expect(fakeCF.updatedRecords).To(HaveLen(1))
+			Expect(fakeCF.updatedRecords[0].ID).To(Equal("rec-1"))
+			Expect(fakeCF.updatedRecords[0].Proxied).To(BeFalse())
+			Expect(fakeCF.updatedRecords[0].TTL).To(Equal(300))
+		})
+
+		It("should replace the comment and tags of records that do not set them", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: overridesYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			fakeCF.records = []cloudflare.DNSRecord{
+				{ID: "rec-1", Name: "app.example.com", Type: "CNAME", Content: tunnelTarget(), TTL: 300,
+					Comment: "managed by cloudflared-dns-controller", Tags: []string{"team:web"}},
+				{ID: "rec-2", Name: "api.example.com", Type: "CNAME", Content: tunnelTarget(), Proxied: true, TTL: 1,
+					Comment: "added by hand", Tags: []string{"owner:ops"}},
+			}
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCF.updatedRecords).To(HaveLen(1))
+			Expect(fakeCF.updatedRecords[0].ID).To(Equal("rec-2"))
+			Expect(fakeCF.updatedRecords[0].Comment).To(BeEmpty())
+			Expect(fakeCF.updatedRecords[0].Tags).To(BeEmpty())
+		})
+	})
+
+	Context("Multiple tunnels", func() {
+		const (
+			prodYAML = `tunnel: prod-tunnel
+ingress:
+  - hostname: app.example.com
+    service: http://localhost:80
+  - service: http_status:404
+`
+			stagingYAML = `tunnel: staging-tunnel
+ingress:
+  - hostname: app.staging.example.com
+    service: http://localhost:80
+  - service: http_status:404
+`
+		)
+
+		BeforeEach(func() {
+			reconciler.TargetKey = "*.yaml"
+		})
+
+		It("should sync each key against its own tunnel", func() {
+			cm := newConfigMap(map[string]string{"prod.yaml": prodYAML, "staging.yaml": stagingYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			fakeCF.records = []cloudflare.DNSRecord{
+				{ID: "rec-1", Name: "old.staging.example.com", Type: "CNAME", Content: "staging-tunnel.cfargotunnel.com"},
+			}
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCF.createdRecords).To(HaveLen(2))
+			Expect(fakeCF.createdRecords[0].Name).To(Equal("app.example.com"))
+			Expect(fakeCF.createdRecords[0].Content).To(Equal("prod-tunnel.cfargotunnel.com"))
+			Expect(fakeCF.createdRecords[1].Name).To(Equal("app.staging.example.com"))
+			Expect(fakeCF.createdRecords[1].Content).To(Equal("staging-tunnel.cfargotunnel.com"))
+			Expect(fakeCF.deletedIDs).To(ConsistOf("rec-1"))
+
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			Expect(cm.Annotations).To(HaveKeyWithValue(managedKeysAnnotation,
+				`{"prod.yaml":"prod-tunnel","staging.yaml":"staging-tunnel"}`))
+		})
+
+		It("should delete records of a removed key", func() {
+			cm := newConfigMap(map[string]string{"prod.yaml": prodYAML, "staging.yaml": stagingYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("removing the staging key")
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			delete(cm.Data, "staging.yaml")
+			Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+
+			fakeCF.createdRecords = nil
+			fakeCF.records = []cloudflare.DNSRecord{
+				{ID: "rec-1", Name: "app.example.com", Type: "CNAME", Content: "prod-tunnel.cfargotunnel.com"},
+				{ID: "rec-2", Name: "app.staging.example.com", Type: "CNAME", Content: "staging-tunnel.cfargotunnel.com"},
+			}
+
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCF.createdRecords).To(BeEmpty())
+			Expect(fakeCF.deletedIDs).To(ConsistOf("rec-2"))
+
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			Expect(cm.Annotations).To(HaveKeyWithValue(managedKeysAnnotation, `{"prod.yaml":"prod-tunnel"}`))
+		})
+
+		It("should update the record of a hostname moving to another key in place", func() {
+			cm := newConfigMap(map[string]string{"prod.yaml": prodYAML, "staging.yaml": stagingYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("moving app.example.com from the prod key to the staging key")
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			delete(cm.Data, "prod.yaml")
+			cm.Data["staging.yaml"] = `tunnel: staging-tunnel
+ingress:
+  - hostname: app.example.com
+    service: http://localhost:80
+  - hostname: app.staging.example.com
+    service: http://localhost:80
+  - service: http_status:404
+`
+			Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+
+			fakeCF.createdRecords, fakeCF.updatedRecords = nil, nil
+			fakeCF.records = []cloudflare.DNSRecord{
+				{ID: "rec-1", Name: "app.example.com", Type: "CNAME", Content: "prod-tunnel.cfargotunnel.com", Proxied: true, TTL: 1},
+				{ID: "rec-2", Name: "app.staging.example.com", Type: "CNAME", Content: "staging-tunnel.cfargotunnel.com", Proxied: true, TTL: 1},
+			}
+
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCF.createdRecords).To(BeEmpty())
+			Expect(fakeCF.deletedIDs).To(BeEmpty())
+			Expect(fakeCF.updatedRecords).To(HaveLen(1))
+			Expect(fakeCF.updatedRecords[0].ID).To(Equal("rec-1"))
+			Expect(fakeCF.updatedRecords[0].Content).To(Equal("staging-tunnel.cfargotunnel.com"))
+
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			Expect(cm.Annotations).To(HaveKeyWithValue(managedKeysAnnotation, `{"staging.yaml":"staging-tunnel"}`))
+		})
+	})
+
+	Context("Batch changes", func() {
+		BeforeEach(func() {
+			reconciler.BatchChanges = true
+		})
+
+		It("should apply all changes in one batch", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			fakeCF.records = []cloudflare.DNSRecord{
+				{ID: "rec-1", Name: "app.example.com", Type: "CNAME", Content: tunnelTarget(), Proxied: false, TTL: 1},
+				{ID: "rec-2", Name: "removed.example.com", Type: "CNAME", Content: tunnelTarget()},
+			}
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCF.batches).To(HaveLen(1))
+			Expect(fakeCF.batches[0].Creates).To(HaveLen(1))
+			Expect(fakeCF.batches[0].Creates[0].Name).To(Equal("api.example.com"))
+			Expect(fakeCF.batches[0].Updates).To(HaveLen(1))
+			Expect(fakeCF.batches[0].Updates[0].ID).To(Equal("rec-1"))
+			Expect(fakeCF.batches[0].Deletes).To(HaveLen(1))
+			Expect(fakeCF.batches[0].Deletes[0].ID).To(Equal("rec-2"))
+		})
+
+		It("should fall back to per-record calls when the batch fails", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			fakeCF.batchErr = errors.New("batch failed")
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCF.batches).To(BeEmpty())
+			Expect(fakeCF.createdRecords).To(HaveLen(2))
+		})
+
+		It("should not fall back when rate limited", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			fakeCF.batchErr = &cloudflare.APIError{
+				Kind: cloudflare.ErrRateLimited, StatusCode: 429, RetryAfter: time.Minute, Err: errors.New("too many requests"),
+			}
+
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+			Expect(fakeCF.createdRecords).To(BeEmpty())
+		})
+
+		It("should audit and snapshot the batches applied before a rate limit", func() {
+			events := auditTo(reconciler)
+			key := types.NamespacedName{Namespace: testTargetNamespace, Name: "cloudflared-dns-history"}
+			store := history.NewStore(k8sClient, key, 10)
+			reconciler.History = store
+			DeferCleanup(func() {
+				_ = k8sClient.Delete(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}})
+			})
+			fakeCF.records = []cloudflare.DNSRecord{{ID: "rec-2", Name: "removed.example.com", Type: "CNAME", Content: tunnelTarget()}}
+			fakeCF.batchFailOn = "api.example.com"
+			fakeCF.batchErr = &cloudflare.APIError{
+				Kind: cloudflare.ErrRateLimited, StatusCode: 429, RetryAfter: time.Minute, Err: errors.New("too many requests"),
+			}
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+			Expect(fakeCF.deletedIDs).To(ConsistOf("rec-2"))
+			Expect(events()).To(ConsistOf(
+				"removed.example.com delete/success",
+				"app.example.com create/success",
+				"api.example.com create/error",
+			))
+			entries, err := store.List(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Name).To(Equal("removed.example.com"))
+		})
+
+		It("should fall back only for the changes of failed batches", func() {
+			events := auditTo(reconciler)
+			fakeCF.batchFailOn = "api.example.com"
+			fakeCF.batchErr = errors.New("batch failed")
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.createdRecords).To(HaveLen(2))
+			Expect(events()).To(Equal([]string{
+				"app.example.com create/success",
+				"api.example.com create/error",
+				"api.example.com create/success",
+			}))
+		})
+	})
+
+	Context("Parallel changes", func() {
+		It("should apply many records concurrently", func() {
+			reconciler.ApplyConcurrency = 4
+			var cfg strings.Builder
+			cfg.WriteString("tunnel: test-tunnel-id\ningress:\n")
+			for i := range 20 {
+				fmt.Fprintf(&cfg, "  - hostname: app%d.example.com\n    service: http://localhost:80\n", i)
+			}
+			cfg.WriteString("  - service: http_status:404\n")
+			cm := newConfigMap(map[string]string{testTargetKey: cfg.String()})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.createdRecords).To(HaveLen(20))
+		})
+
+		It("should keep the old record when its replacement fails", func() {
+			reconciler.ApplyConcurrency = 4
+			fakeCF.records = []cloudflare.DNSRecord{
+				{ID: "old-app", Name: "app.example.com", Type: "CNAME", Content: "old-tunnel.cfargotunnel.com"},
+				{ID: "old-api", Name: "api.example.com", Type: "CNAME", Content: "old-tunnel.cfargotunnel.com"},
+			}
+			fakeCF.createErr = errors.New("create failed")
+
+			deleted, err := reconciler.applyRecords(ctx, logr.Discard(), cloudflare.Plan{
+				Creates: []cloudflare.DNSRecord{{Name: "app.example.com", Type: "CNAME", Content: tunnelTarget()}},
+				Deletes: slices.Clone(fakeCF.records),
+			})
+			Expect(err).To(MatchError(ContainSubstring("app.example.com: create failed")))
+			Expect(fakeCF.deletedIDs).To(Equal([]string{"old-api"}))
+			Expect(deleted).To(HaveLen(1))
+			Expect(deleted[0].ID).To(Equal("old-api"))
+		})
+	})
+
+	Context("Change detection", func() {
+		It("should record the desired state and the applied plan", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			hash, err := reconciler.desiredHash(cm)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cm.Annotations).To(HaveKeyWithValue(desiredHashAnnotation, hash))
+			Expect(cm.Annotations).To(HaveKeyWithValue(lastAppliedPlanAnnotation,
+				`{"creates":["app.example.com","api.example.com"]}`))
+		})
+
+		It("should only pass updates that change the desired state", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+
+			pred := reconciler.contentChangedPredicate()
+			update := func(mutate func(cm *corev1.ConfigMap)) bool {
+				updated := cm.DeepCopy()
+				mutate(updated)
+				return pred.Update(event.UpdateEvent{ObjectOld: cm, ObjectNew: updated})
+			}
+
+			Expect(update(func(cm *corev1.ConfigMap) {
+				cm.Labels = map[string]string{"touched": "true"}
+			})).To(BeFalse())
+			Expect(update(func(cm *corev1.ConfigMap) {
+				cm.Data["other.txt"] = "unrelated"
+			})).To(BeFalse())
+			Expect(update(func(cm *corev1.ConfigMap) {
+				cm.Data[testTargetKey] = "# reformatted\n" + configYAML
+			})).To(BeFalse())
+			Expect(update(func(cm *corev1.ConfigMap) {
+				cm.Data[testTargetKey] = strings.Replace(configYAML, "api.example.com", "new.example.com", 1)
+			})).To(BeTrue())
+			Expect(update(func(cm *corev1.ConfigMap) {
+				cm.Annotations[dnsOverridesAnnotation] = `{"app.example.com": {"proxied": false}}`
+			})).To(BeTrue())
+			Expect(update(func(cm *corev1.ConfigMap) {
+				now := metav1.Now()
+				cm.DeletionTimestamp = &now
+			})).To(BeTrue())
+		})
+	})
+
+	Context("Metrics", func() {
+		It("should report managed records and the last successful sync", func() {
+			reconciler.ZoneID = "zone-1"
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			source := req.NamespacedName.String()
+			Expect(testutil.ToFloat64(metrics.ManagedRecords.WithLabelValues("zone-1", testTunnelID, source))).To(Equal(2.0))
+			Expect(testutil.ToFloat64(metrics.PendingChanges.WithLabelValues(source, "create"))).To(BeZero())
+			Expect(testutil.ToFloat64(metrics.LastSuccessfulSync.WithLabelValues(source))).To(BeNumerically(">", 0))
+		})
+
+		It("should leave pending changes when applying fails", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			fakeCF.createErr = errors.New("create failed")
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).To(HaveOccurred())
+			Expect(testutil.ToFloat64(metrics.PendingChanges.WithLabelValues(req.NamespacedName.String(), "create"))).
+				To(Equal(2.0))
+		})
+	})
+
+	Context("Tracing", func() {
+		It("should trace the reconcile with its source, tunnels and plan size", func() {
+			recorder := tracetest.NewSpanRecorder()
+			previous := otel.GetTracerProvider()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+			DeferCleanup(otel.SetTracerProvider, previous)
+
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Name()).To(Equal("Reconcile"))
+			Expect(spans[0].Attributes()).To(ContainElements(
+				attribute.String("source", req.NamespacedName.String()),
+				attribute.StringSlice("cloudflared.tunnels", []string{testTunnelID}),
+				attribute.Int("plan.creates", 2),
+				attribute.Int("plan.deletes", 0),
+			))
+		})
+	})
+
+	Context("Audit", func() {
+		It("should append an audit event for every record change", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+			auditLogger, err := audit.New(logr.Discard(), path)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(auditLogger.Close)
+			reconciler.Audit = auditLogger
+
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			data, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			Expect(lines).To(HaveLen(2))
+			for _, line := range lines {
+				var ev audit.Event
+				Expect(json.Unmarshal([]byte(line), &ev)).To(Succeed())
+				Expect(ev.Action).To(Equal(audit.ActionCreate))
+				Expect(ev.Result).To(Equal(audit.ResultSuccess))
+				Expect(ev.Source).To(Equal(req.NamespacedName.String()))
+				Expect(ev.ResourceVersion).NotTo(BeEmpty())
+				Expect(ev.Tunnel).To(Equal(testTunnelID))
+				Expect(ev.Before).To(BeNil())
+				Expect(ev.After.ID).To(HavePrefix("created-"))
+				Expect(ev.After.Name).To(Equal(ev.Hostname))
+			}
+		})
+	})
+
+	Context("Notifications", func() {
+		var payloads chan notify.Event
+
+		BeforeEach(func() {
+			payloads = make(chan notify.Event, 10)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var ev notify.Event
+				Expect(json.NewDecoder(r.Body).Decode(&ev)).To(Succeed())
+				payloads <- ev
+			}))
+			DeferCleanup(srv.Close)
+			hook, err := notify.NewWebhook(srv.URL, notify.FormatGeneric, "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			reconciler.Notifier = notify.New([]notify.Webhook{hook}, notify.Options{FailureThreshold: 2}, logr.Discard())
+			notifyCtx, cancel := context.WithCancel(ctx)
+			DeferCleanup(cancel)
+			go func() { _ = reconciler.Notifier.Start(notifyCtx) }()
+		})
+
+		It("should post the applied plan", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			var ev notify.Event
+			Eventually(payloads).Should(Receive(&ev))
+			Expect(ev.Kind).To(Equal(notify.KindApplied))
+			Expect(ev.Source).To(Equal(req.NamespacedName.String()))
+			Expect(ev.Tunnels).To(ConsistOf(testTunnelID))
+			Expect(ev.Created).To(HaveLen(2))
+
+			// Nothing left to change.
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Consistently(payloads, 100*time.Millisecond).ShouldNot(Receive())
+		})
+
+		It("should post failures once they persist", func() {
+			fakeCF.createErr = errors.New("create failed")
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).To(HaveOccurred())
+			Consistently(payloads, 100*time.Millisecond).ShouldNot(Receive())
+
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).To(HaveOccurred())
+			var ev notify.Event
+			Eventually(payloads).Should(Receive(&ev))
+			Expect(ev.Kind).To(Equal(notify.KindFailed))
+			Expect(ev.Failures).To(Equal(2))
+			Expect(ev.Error).To(ContainSubstring("create failed"))
+		})
+	})
+
+	Context("History", func() {
+		var store *history.Store
+
+		BeforeEach(func() {
+			key := types.NamespacedName{Namespace: testTargetNamespace, Name: "cloudflared-dns-history"}
+			store = history.NewStore(k8sClient, key, 10)
+			reconciler.History = store
+			DeferCleanup(func() {
+				_ = k8sClient.Delete(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}})
+			})
+		})
+
+		It("should snapshot deleted records and restore them from the annotation", func() {
+			fakeCF.records = []cloudflare.DNSRecord{{
+				ID: "old-1", Name: "old.example.com", Type: "CNAME", Content: tunnelTarget(), TTL: 300, Comment: "legacy",
+			}}
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.deletedIDs).To(ConsistOf("old-1"))
+
+			entries, err := store.List(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Source).To(Equal(req.NamespacedName.String()))
+			Expect(entries[0].Record()).To(Equal(cloudflare.DNSRecord{
+				Name: "old.example.com", Type: "CNAME", Content: tunnelTarget(), TTL: 300, Comment: "legacy",
+			}))
+
+			By("restoring the record and dropping hostnames that cannot be restored")
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			cm.Annotations[history.RestoreAnnotation] = "old.example.com,app.example.com,missing.example.com"
+			Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.createdRecords).To(HaveLen(3))
+			Expect(fakeCF.createdRecords[2]).To(Equal(entries[0].Record()))
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			Expect(cm.Annotations).To(HaveKeyWithValue(history.RestoreAnnotation, "old.example.com"))
+
+			By("keeping the restored record on later syncs")
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.deletedIDs).To(HaveLen(1))
+
+			By("deleting it again once the hostname is removed from the annotation")
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			delete(cm.Annotations, history.RestoreAnnotation)
+			Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.deletedIDs).To(HaveLen(2))
+		})
+
+		It("should only snapshot records that were deleted", func() {
+			fakeCF.records = []cloudflare.DNSRecord{{ID: "old-1", Name: "old.example.com", Type: "CNAME", Content: tunnelTarget()}}
+			fakeCF.deleteErr = errors.New("delete failed")
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).To(MatchError(ContainSubstring("delete failed")))
+			entries, err := store.List(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+
+			By("snapshotting the record once its delete succeeds")
+			fakeCF.deleteErr = nil
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			entries, err = store.List(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Name).To(Equal("old.example.com"))
+		})
+
+		It("should report deleted records it could not snapshot", func() {
+			broken := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "broken-history", Namespace: testTargetNamespace},
+				Data:       map[string]string{history.DataKey: "not json"},
+			}
+			Expect(k8sClient.Create(ctx, broken)).To(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, broken)).To(Succeed()) })
+			reconciler.History = history.NewStore(k8sClient, client.ObjectKeyFromObject(broken), 10)
+			fakeCF.records = []cloudflare.DNSRecord{{ID: "old-1", Name: "old.example.com", Type: "CNAME", Content: tunnelTarget()}}
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).To(MatchError(ContainSubstring("unable to write history")))
+			Expect(fakeCF.deletedIDs).To(ConsistOf("old-1"))
+		})
+	})
+
+	Context("Deletion grace period", func() {
+		It("should delete removed hostnames only once the grace period has passed", func() {
+			reconciler.DeletionGracePeriod = 2 * time.Minute
+			fakeCF.records = []cloudflare.DNSRecord{{ID: "old-1", Name: "old.example.com", Type: "CNAME", Content: tunnelTarget()}}
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			cm.Annotations = map[string]string{pendingDeletionsAnnotation: `{"back.example.com":"2026-01-01T00:00:00Z"}`}
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.deletedIDs).To(BeEmpty())
+			Expect(result.RequeueAfter).To(BeNumerically("~", 2*time.Minute, time.Second))
+
+			By("marking the hostname pending and dropping hostnames that are no longer removed")
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			pending := pendingDeletions(cm)
+			Expect(pending).To(HaveLen(1))
+			Expect(pending).To(HaveKey("old.example.com"))
+			source := req.NamespacedName.String()
+			Expect(testutil.ToFloat64(metrics.PendingDeletion.WithLabelValues(source, "old.example.com"))).
+				To(Equal(float64(pending["old.example.com"].Unix())))
+
+			By("deleting the record once the grace period has passed")
+			cm.Annotations[pendingDeletionsAnnotation] = fmt.Sprintf(`{"old.example.com":%q}`,
+				time.Now().Add(-3*time.Minute).UTC().Format(time.RFC3339))
+			Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+			result, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.deletedIDs).To(ConsistOf("old-1"))
+			Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			Expect(cm.Annotations).NotTo(HaveKey(pendingDeletionsAnnotation))
+			Expect(testutil.CollectAndCount(metrics.PendingDeletion)).To(BeZero())
+		})
+	})
+
+	Context("Approval", func() {
+		BeforeEach(func() {
+			reconciler.RequireApproval = true
+			fakeCF.records = []cloudflare.DNSRecord{{ID: "old-1", Name: "old.example.com", Type: "CNAME", Content: tunnelTarget()}}
+		})
+
+		It("should apply destructive changes only once their plan is approved", func() {
+			reconciler.AutoApproveCreates = true
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.createdRecords).To(HaveLen(2))
+			Expect(fakeCF.deletedIDs).To(BeEmpty())
+
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			Expect(cm.Annotations).To(HaveKeyWithValue(pendingPlanAnnotation, `{"deletes":["old.example.com"]}`))
+			hash := cm.Annotations[pendingPlanHashAnnotation]
+			Expect(hash).NotTo(BeEmpty())
+
+			By("waiting while the approval does not match")
+			cm.Annotations[approvedPlanAnnotation] = "stale"
+			Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.deletedIDs).To(BeEmpty())
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			Expect(cm.Annotations).To(HaveKeyWithValue(pendingPlanHashAnnotation, hash))
+
+			By("applying the plan once approved")
+			approved := cm.DeepCopy()
+			approved.Annotations[approvedPlanAnnotation] = hash
+			Expect(reconciler.contentChangedPredicate().Update(event.UpdateEvent{ObjectOld: cm, ObjectNew: approved})).To(BeTrue())
+			Expect(k8sClient.Update(ctx, approved)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.deletedIDs).To(ConsistOf("old-1"))
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			Expect(cm.Annotations).NotTo(HaveKey(pendingPlanAnnotation))
+			Expect(cm.Annotations).NotTo(HaveKey(pendingPlanHashAnnotation))
+			Expect(cm.Annotations).NotTo(HaveKey(approvedPlanAnnotation))
+		})
+
+		It("should hold back creates unless they are auto-approved", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.createdRecords).To(BeEmpty())
+			Expect(fakeCF.deletedIDs).To(BeEmpty())
+
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			cm.Annotations[approvedPlanAnnotation] = cm.Annotations[pendingPlanHashAnnotation]
+			Expect(k8sClient.Update(ctx, cm)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.createdRecords).To(HaveLen(2))
+			Expect(fakeCF.deletedIDs).To(ConsistOf("old-1"))
+		})
+
+		It("should track pending deletions while the plan waits for approval", func() {
+			reconciler.DeletionGracePeriod = 2 * time.Minute
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.createdRecords).To(BeEmpty())
+
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			Expect(cm.Annotations).To(HaveKey(pendingPlanHashAnnotation))
+			pending := pendingDeletions(cm)
+			Expect(pending).To(HaveKey("old.example.com"))
+			Expect(testutil.ToFloat64(metrics.PendingDeletion.WithLabelValues(req.NamespacedName.String(), "old.example.com"))).
+				To(Equal(float64(pending["old.example.com"].Unix())))
+		})
+	})
+
+	Context("Per-source credentials", func() {
+		var sourceCF *fakeCloudflareClient
+
+		BeforeEach(func() {
+			sourceCF = &fakeCloudflareClient{}
+			reconciler.Clients = credentials.NewPool(func(creds credentials.Credentials) cloudflare.Client {
+				Expect(creds).To(Equal(credentials.Credentials{APIToken: "unit-token", ZoneID: "unit-zone"}))
+				return sourceCF
+			})
+		})
+
+		newSecret := func() *corev1.Secret {
+			return &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "unit-credentials", Namespace: testTargetNamespace},
+				Data: map[string][]byte{
+					credentials.SecretAPITokenKey: []byte("unit-token"),
+					credentials.SecretZoneIDKey:   []byte("unit-zone"),
+				},
+			}
+		}
+
+		It("should manage records with the referenced Secret's credentials", func() {
+			secret := newSecret()
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, secret)).To(Succeed()) })
+
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			cm.Annotations = map[string]string{credentialsSecretAnnotation: secret.Name}
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(sourceCF.createdRecords).To(HaveLen(2))
+			Expect(fakeCF.createdRecords).To(BeEmpty())
+			Expect(reconciler.secretToConfigMap(ctx, secret)).To(ConsistOf(req))
+		})
+
+		It("should fail when the referenced Secret is missing", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			cm.Annotations = map[string]string{credentialsSecretAnnotation: "missing"}
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).To(MatchError(ContainSubstring("unable to read credentials secret missing")))
+			Expect(fakeCF.createdRecords).To(BeEmpty())
+		})
+
+		It("should clean up with the last known credentials once the Secret is gone", func() {
+			secret := newSecret()
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			cm.Annotations = map[string]string{credentialsSecretAnnotation: secret.Name}
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sourceCF.createdRecords).To(HaveLen(2))
+
+			By("deleting the Secret before the ConfigMap")
+			Expect(k8sClient.Delete(ctx, secret)).To(Succeed())
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, cm)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sourceCF.deletedIDs).To(HaveLen(2))
+			Expect(fakeCF.deletedIDs).To(BeEmpty())
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, req.NamespacedName, cm))).To(BeTrue())
+			_, _, ok := reconciler.Clients.Last(req.NamespacedName.String())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should mark the deletion blocked when no credentials are known", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			cm.Annotations = map[string]string{credentialsSecretAnnotation: "missing"}
+			cm.Finalizers = []string{finalizerName}
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, cm)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, req.NamespacedName, cm)).To(Succeed())
+			Expect(cm.Annotations[deletionBlockedAnnotation]).To(ContainSubstring("unable to read credentials secret missing"))
+			Expect(controllerutil.ContainsFinalizer(cm, finalizerName)).To(BeTrue())
+			Expect(fakeCF.deletedIDs).To(BeEmpty())
+		})
+	})
+
 	Context("Error handling", func() {
 		It("should return error when ListDNSRecords fails", func() {
 			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
@@ -216,6 +1133,82 @@ var _ = Describe("CloudflaredDNS Controller", func() {
 			Expect(err).To(MatchError(ContainSubstring("cloudflare api error")))
 		})
 
+		It("should requeue after Retry-After when Cloudflare rate limits", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			fakeCF.listErr = &cloudflare.APIError{
+				Kind:       cloudflare.ErrRateLimited,
+				StatusCode: 429,
+				RetryAfter: 42 * time.Second,
+				Err:        errors.New("too many requests"),
+			}
+
+			result, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(42 * time.Second))
+		})
+
+		It("should treat an already deleted record as deleted", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			fakeCF.records = []cloudflare.DNSRecord{
+				{ID: "rec-1", Name: "app.example.com", Type: "CNAME", Content: tunnelTarget(), Proxied: true, TTL: 1},
+				{ID: "rec-2", Name: "api.example.com", Type: "CNAME", Content: tunnelTarget(), Proxied: true, TTL: 1},
+				{ID: "rec-3", Name: "removed.example.com", Type: "CNAME", Content: tunnelTarget()},
+			}
+			fakeCF.deleteErr = &cloudflare.APIError{Kind: cloudflare.ErrNotFound, StatusCode: 404, Err: errors.New("not found")}
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should adopt a record that already exists for the tunnel and fail on one owned by anything else", func() {
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			fakeCF.createErr = &cloudflare.APIError{
+				Kind: cloudflare.ErrAlreadyExists, StatusCode: 400, Err: errors.New("record already exists"),
+			}
+			fakeCF.listHook = func() {
+				// Another writer created the record between listing and creating.
+				fakeCF.records = []cloudflare.DNSRecord{
+					{ID: "rec-1", Name: "app.example.com", Type: "CNAME", Content: tunnelTarget(), Proxied: false, TTL: 1},
+					{ID: "rec-2", Name: "api.example.com", Type: "A", Content: "192.0.2.1"},
+				}
+			}
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).To(MatchError(ContainSubstring("api.example.com: hostname is already used by another DNS record")))
+			Expect(errors.Is(err, cloudflare.ErrAlreadyExists)).To(BeTrue())
+
+			Expect(fakeCF.updatedRecords).To(HaveLen(1))
+			Expect(fakeCF.updatedRecords[0].ID).To(Equal("rec-1"))
+			Expect(fakeCF.updatedRecords[0].Proxied).To(BeTrue())
+		})
+
+		It("should audit adopting a record that is already in place", func() {
+			events := auditTo(reconciler)
+			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+			fakeCF.createErr = &cloudflare.APIError{
+				Kind: cloudflare.ErrAlreadyExists, StatusCode: 400, Err: errors.New("record already exists"),
+			}
+			fakeCF.listHook = func() {
+				fakeCF.records = []cloudflare.DNSRecord{
+					{ID: "rec-1", Name: "app.example.com", Type: "CNAME", Content: tunnelTarget(), Proxied: true, TTL: 1},
+					{ID: "rec-2", Name: "api.example.com", Type: "CNAME", Content: tunnelTarget(), Proxied: true, TTL: 1},
+				}
+			}
+
+			_, err := reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeCF.updatedRecords).To(BeEmpty())
+			Expect(events()).To(ConsistOf("app.example.com adopt/success", "api.example.com adopt/success"))
+		})
+
 		It("should return error when CreateDNSRecord fails", func() {
 			cm := newConfigMap(map[string]string{testTargetKey: configYAML})
 			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
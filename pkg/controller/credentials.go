@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+	"github.com/seipan/cloudflared-dns-controller/pkg/credentials"
+)
+
+// credentialsSecretAnnotation names a Secret in the ConfigMap's namespace whose
+// api-token and zone-id keys are used instead of the controller's credentials.
+const credentialsSecretAnnotation = "cloudflared-dns-controller.seipan.github.io/credentials-secret"
+
+// deletionBlockedAnnotation explains why the records of a deleted ConfigMap
+// cannot be cleaned up. Remove the finalizer to let it go without cleanup.
+const deletionBlockedAnnotation = "cloudflared-dns-controller.seipan.github.io/deletion-blocked"
+
+type sourceClientKey struct{}
+
+// sourceClient is the Cloudflare client of the ConfigMap being reconciled.
+type sourceClient struct {
+	client cloudflare.Client
+	zoneID string
+}
+
+// withSourceClient resolves the client of the Secret cm references, if any.
+// Only Secrets in the ConfigMap's own namespace can be referenced, so a source
+// cannot use credentials its namespace has no access to.
+func (r *CloudflaredDNSReconciler) withSourceClient(ctx context.Context, cm *corev1.ConfigMap) (context.Context, error) {
+	name, ok := cm.Annotations[credentialsSecretAnnotation]
+	if !ok {
+		return ctx, nil
+	}
+	if r.Clients == nil {
+		return ctx, fmt.Errorf("annotation %s is set but per-source credentials are disabled", credentialsSecretAnnotation)
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: cm.Namespace, Name: name}, secret); err != nil {
+		return ctx, fmt.Errorf("unable to read credentials secret %s: %w", name, err)
+	}
+	creds, err := credentials.FromSecret(secret)
+	if err != nil {
+		return ctx, err
+	}
+	source := client.ObjectKeyFromObject(cm).String()
+	return context.WithValue(ctx, sourceClientKey{}, sourceClient{client: r.Clients.Get(source, creds), zoneID: creds.ZoneID}), nil
+}
+
+// withDeletionClient resolves the client used to clean up the records of a
+// deleted cm. The referenced Secret is often deleted first, so it falls back to
+// the credentials the source last used.
+func (r *CloudflaredDNSReconciler) withDeletionClient(ctx context.Context, cm *corev1.ConfigMap) (context.Context, error) {
+	ctx, err := r.withSourceClient(ctx, cm)
+	if err == nil || r.Clients == nil {
+		return ctx, err
+	}
+	c, creds, ok := r.Clients.Last(client.ObjectKeyFromObject(cm).String())
+	if !ok {
+		return ctx, err
+	}
+	ctrl.LoggerFrom(ctx).Info("Cleaning up with the last known credentials", "reason", err.Error())
+	return context.WithValue(ctx, sourceClientKey{}, sourceClient{client: c, zoneID: creds.ZoneID}), nil
+}
+
+// blockDeletion records on cm why its records cannot be cleaned up and waits
+// for the Secret to come back instead of retrying.
+func (r *CloudflaredDNSReconciler) blockDeletion(
+	ctx context.Context, log logr.Logger, cm *corev1.ConfigMap, reason error,
+) (ctrl.Result, error) {
+	log.Error(reason, "unable to clean up DNS records of deleted ConfigMap; "+
+		"restore the credentials Secret or remove the finalizer to skip the cleanup")
+	if cm.Annotations[deletionBlockedAnnotation] == reason.Error() {
+		return ctrl.Result{}, nil
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[deletionBlockedAnnotation] = reason.Error()
+	return ctrl.Result{}, r.Update(ctx, cm)
+}
+
+// cloudflareClient returns the client of the ConfigMap being reconciled.
+func (r *CloudflaredDNSReconciler) cloudflareClient(ctx context.Context) cloudflare.Client {
+	if src, ok := ctx.Value(sourceClientKey{}).(sourceClient); ok {
+		return src.client
+	}
+	return r.Cloudflare
+}
+
+// zoneID returns the zone of the ConfigMap being reconciled. The controller's
+// own client knows its current zone, which changes when credentials rotate.
+func (r *CloudflaredDNSReconciler) zoneID(ctx context.Context) string {
+	if src, ok := ctx.Value(sourceClientKey{}).(sourceClient); ok {
+		return src.zoneID
+	}
+	if z, ok := r.Cloudflare.(cloudflare.Zoner); ok {
+		if zoneID := z.ZoneID(ctx); zoneID != "" {
+			return zoneID
+		}
+	}
+	return r.ZoneID
+}
+
+// secretToConfigMap requeues the target ConfigMap when the Secret it references
+// changes, so rotated credentials are used right away.
+func (r *CloudflaredDNSReconciler) secretToConfigMap(ctx context.Context, obj client.Object) []reconcile.Request {
+	key := types.NamespacedName{Name: r.TargetName, Namespace: r.TargetNamespace}
+	if obj.GetNamespace() != key.Namespace {
+		return nil
+	}
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, key, cm); err != nil {
+		return nil
+	}
+	if cm.Annotations[credentialsSecretAnnotation] != obj.GetName() {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: key}}
+}
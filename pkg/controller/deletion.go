@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"encoding/json"
+	"maps"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+	"github.com/seipan/cloudflared-dns-controller/pkg/metrics"
+)
+
+// pendingDeletionsAnnotation maps the hostnames waiting out the deletion grace
+// period to when they were found removed, as JSON.
+const pendingDeletionsAnnotation = "cloudflared-dns-controller.seipan.github.io/pending-deletions"
+
+// deferDeletions holds back the deletes of hostnames removed less than
+// DeletionGracePeriod ago. It returns the deletes that are due, the hostnames
+// still pending, and how long until the next of them is due.
+func (r *CloudflaredDNSReconciler) deferDeletions(
+	log logr.Logger, deletes []cloudflare.DNSRecord, pending map[string]time.Time, now time.Time,
+) ([]cloudflare.DNSRecord, map[string]time.Time, time.Duration) {
+	var due []cloudflare.DNSRecord
+	stillPending := make(map[string]time.Time)
+	var next time.Duration
+	for _, rec := range deletes {
+		since, found := pending[rec.Name]
+		if !found {
+			since = now
+		}
+		remaining := since.Add(r.DeletionGracePeriod).Sub(now)
+		if remaining <= 0 {
+			due = append(due, rec)
+			continue
+		}
+		if !found {
+			log.Info("Hostname removed, deleting its record after the grace period", "hostname", rec.Name, "after", remaining)
+		}
+		stillPending[rec.Name] = since
+		if next == 0 || remaining < next {
+			next = remaining
+		}
+	}
+	return due, stillPending, next
+}
+
+// pendingDeletions reads pendingDeletionsAnnotation. An unreadable value starts
+// the grace period over rather than deleting early.
+func pendingDeletions(cm *corev1.ConfigMap) map[string]time.Time {
+	pending := map[string]time.Time{}
+	if v, ok := cm.Annotations[pendingDeletionsAnnotation]; ok {
+		_ = json.Unmarshal([]byte(v), &pending)
+	}
+	return pending
+}
+
+// setPendingDeletions records pending on cm and reports whether it changed.
+func setPendingDeletions(cm *corev1.ConfigMap, pending map[string]time.Time) (bool, error) {
+	if maps.EqualFunc(pending, pendingDeletions(cm), time.Time.Equal) {
+		return false, nil
+	}
+	if len(pending) == 0 {
+		delete(cm.Annotations, pendingDeletionsAnnotation)
+		return true, nil
+	}
+	v, err := json.Marshal(pending)
+	if err != nil {
+		return false, err
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[pendingDeletionsAnnotation] = string(v)
+	return true, nil
+}
+
+func setPendingDeletionMetrics(source string, pending map[string]time.Time) {
+	metrics.PendingDeletion.DeletePartialMatch(prometheus.Labels{"source": source})
+	for hostname, since := range pending {
+		metrics.PendingDeletion.WithLabelValues(source, hostname).Set(float64(since.Unix()))
+	}
+}
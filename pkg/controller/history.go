@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+	"github.com/seipan/cloudflared-dns-controller/pkg/config"
+	"github.com/seipan/cloudflared-dns-controller/pkg/history"
+)
+
+// snapshot saves deleted records to the history.
+func (r *CloudflaredDNSReconciler) snapshot(ctx context.Context, recs []cloudflare.DNSRecord) error {
+	if r.History == nil || len(recs) == 0 {
+		return nil
+	}
+	src, _ := ctx.Value(auditSourceKey{}).(auditSource)
+	now := time.Now()
+	entries := make([]history.Entry, 0, len(recs))
+	for _, rec := range recs {
+		entries = append(entries, history.NewEntry(now, src.source, r.zoneID(ctx), rec))
+	}
+	return r.History.Append(ctx, entries...)
+}
+
+// restoredRecords returns, per tunnel, the history records of the hostnames in
+// the restore annotation, and rewrites the annotation without the hostnames
+// that cannot or no longer need to be restored. It reports whether cm changed.
+func (r *CloudflaredDNSReconciler) restoredRecords(
+	ctx context.Context, log logr.Logger, cm *corev1.ConfigMap, sources []source, overrides map[string]config.DNSSettings,
+) (map[string][]cloudflare.DNSRecord, bool, error) {
+	hostnames := restoreHostnames(cm)
+	if len(hostnames) == 0 {
+		return nil, false, nil
+	}
+	if r.History == nil {
+		return nil, false, fmt.Errorf("annotation %s is set but the record history is disabled", history.RestoreAnnotation)
+	}
+	entries, err := r.History.List(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	desired := make(map[string]struct{})
+	for _, tunnel := range tunnels(sources) {
+		for _, rec := range r.desiredRecords(sources, tunnel, overrides) {
+			desired[rec.Name] = struct{}{}
+		}
+	}
+	src, _ := ctx.Value(auditSourceKey{}).(auditSource)
+	restored := make(map[string][]cloudflare.DNSRecord)
+	var pending []string
+	for _, hostname := range hostnames {
+		if _, found := desired[hostname]; found {
+			log.Info("Hostname to restore is in the ingress again", "hostname", hostname)
+			continue
+		}
+		entry, found := history.Latest(entries, src.source, hostname)
+		if !found {
+			log.Info("No deleted record to restore", "hostname", hostname)
+			continue
+		}
+		rec := entry.Record()
+		i := slices.IndexFunc(tunnels(sources), func(tunnel string) bool {
+			return r.Cloudflare.IsTunnelRecord(rec, tunnel)
+		})
+		if i < 0 {
+			log.Info("Deleted record points at a tunnel the ConfigMap no longer uses", "hostname", hostname, "content", rec.Content)
+			continue
+		}
+		tunnel := tunnels(sources)[i]
+		restored[tunnel] = append(restored[tunnel], rec)
+		pending = append(pending, hostname)
+	}
+
+	value := strings.Join(pending, ",")
+	if value == cm.Annotations[history.RestoreAnnotation] {
+		return restored, false, nil
+	}
+	if value == "" {
+		delete(cm.Annotations, history.RestoreAnnotation)
+	} else {
+		cm.Annotations[history.RestoreAnnotation] = value
+	}
+	return restored, true, nil
+}
+
+func restoreHostnames(cm *corev1.ConfigMap) []string {
+	var hostnames []string
+	for hostname := range strings.SplitSeq(cm.Annotations[history.RestoreAnnotation], ",") {
+		if hostname = strings.TrimSpace(hostname); hostname != "" && !slices.Contains(hostnames, hostname) {
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	return hostnames
+}
@@ -2,38 +2,80 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"sync"
 
 	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
 )
 
 type fakeCloudflareClient struct {
+	mu      sync.Mutex
 	records []cloudflare.DNSRecord
 
 	createdRecords []cloudflare.DNSRecord
+	updatedRecords []cloudflare.DNSRecord
 	deletedIDs     []string
+	batches        []cloudflare.Plan
+
+	// listHook runs after each successful list, to change records between calls.
+	listHook func()
 
 	listErr   error
 	createErr error
+	updateErr error
 	deleteErr error
+	batchErr  error
+	// batchFailOn sends each hostname's changes as its own batch and fails
+	// only the batch of this hostname with batchErr.
+	batchFailOn string
 }
 
 func (f *fakeCloudflareClient) ListDNSRecords(_ context.Context) ([]cloudflare.DNSRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if f.listErr != nil {
 		return nil, f.listErr
 	}
-	return f.records, nil
+	records := slices.Clone(f.records)
+	if f.listHook != nil {
+		f.listHook()
+	}
+	return records, nil
 }
 
-func (f *fakeCloudflareClient) CreateDNSRecord(_ context.Context, record cloudflare.DNSRecord) error {
+func (f *fakeCloudflareClient) CreateDNSRecord(
+	_ context.Context, record cloudflare.DNSRecord,
+) (cloudflare.DNSRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if f.createErr != nil {
-		return f.createErr
+		return cloudflare.DNSRecord{}, f.createErr
 	}
 	f.createdRecords = append(f.createdRecords, record)
+	record.ID = fmt.Sprintf("created-%d", len(f.createdRecords))
 	f.records = append(f.records, record)
+	return record, nil
+}
+
+func (f *fakeCloudflareClient) UpdateDNSRecord(_ context.Context, record cloudflare.DNSRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.updateErr != nil {
+		return f.updateErr
+	}
+	f.updatedRecords = append(f.updatedRecords, record)
+	for i, rec := range f.records {
+		if rec.ID == record.ID {
+			f.records[i] = record
+		}
+	}
 	return nil
 }
 
 func (f *fakeCloudflareClient) DeleteDNSRecord(_ context.Context, recordID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if f.deleteErr != nil {
 		return f.deleteErr
 	}
@@ -48,6 +90,79 @@ func (f *fakeCloudflareClient) DeleteDNSRecord(_ context.Context, recordID strin
 	return nil
 }
 
+func (f *fakeCloudflareClient) ApplyPlan(ctx context.Context, plan cloudflare.Plan) ([]cloudflare.BatchResult, error) {
+	batches := []cloudflare.Plan{plan}
+	if f.batchFailOn != "" {
+		batches = byHostname(plan)
+	}
+	var results []cloudflare.BatchResult
+	for _, batch := range batches {
+		f.mu.Lock()
+		err := f.batchErr
+		if f.batchFailOn != "" && !slices.ContainsFunc(slices.Concat(batch.Deletes, batch.Updates, batch.Creates),
+			func(rec cloudflare.DNSRecord) bool { return rec.Name == f.batchFailOn }) {
+			err = nil
+		}
+		if err == nil {
+			f.batches = append(f.batches, batch)
+		}
+		f.mu.Unlock()
+		if err != nil {
+			return append(results, cloudflare.BatchResult{Plan: batch, Err: err}), err
+		}
+		result := cloudflare.BatchResult{Plan: batch}
+		for _, rec := range batch.Deletes {
+			if err := f.DeleteDNSRecord(ctx, rec.ID); err != nil {
+				return results, err
+			}
+		}
+		for _, rec := range batch.Updates {
+			if err := f.UpdateDNSRecord(ctx, rec); err != nil {
+				return results, err
+			}
+		}
+		for _, rec := range batch.Creates {
+			rec, err := f.CreateDNSRecord(ctx, rec)
+			if err != nil {
+				return results, err
+			}
+			result.Created = append(result.Created, rec)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// byHostname splits plan into one plan per hostname.
+func byHostname(plan cloudflare.Plan) []cloudflare.Plan {
+	var names []string
+	plans := map[string]*cloudflare.Plan{}
+	get := func(name string) *cloudflare.Plan {
+		if _, ok := plans[name]; !ok {
+			plans[name] = &cloudflare.Plan{}
+			names = append(names, name)
+		}
+		return plans[name]
+	}
+	for _, rec := range plan.Deletes {
+		p := get(rec.Name)
+		p.Deletes = append(p.Deletes, rec)
+	}
+	for _, rec := range plan.Updates {
+		p := get(rec.Name)
+		p.Updates = append(p.Updates, rec)
+	}
+	for _, rec := range plan.Creates {
+		p := get(rec.Name)
+		p.Creates = append(p.Creates, rec)
+	}
+	result := make([]cloudflare.Plan, 0, len(names))
+	for _, name := range names {
+		result = append(result, *plans[name])
+	}
+	return result
+}
+
 func (f *fakeCloudflareClient) IsTunnelRecord(rec cloudflare.DNSRecord, tunnelID string) bool {
 	return rec.Type == "CNAME" && rec.Content == tunnelID+".cfargotunnel.com"
 }
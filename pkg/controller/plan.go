@@ -0,0 +1,307 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+	"github.com/seipan/cloudflared-dns-controller/pkg/audit"
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+	"github.com/seipan/cloudflared-dns-controller/pkg/metrics"
+	"github.com/seipan/cloudflared-dns-controller/pkg/notify"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+// applyPlan applies plan and saves the records it deleted to the history.
+// Records whose delete failed or was skipped are not saved, so a restore never
+// recreates a record that still exists.
+func (r *CloudflaredDNSReconciler) applyPlan(ctx context.Context, log logr.Logger, plan cloudflare.Plan) error {
+	if plan.IsEmpty() {
+		return nil
+	}
+	deleted, err := r.applyChanges(ctx, log, plan)
+	return errors.Join(err, r.snapshot(ctx, deleted))
+}
+
+// applyChanges applies plan through the batch endpoint when BatchChanges is
+// set, falling back to one call per record for the changes of batches that
+// were not applied, and returns the deleted records.
+func (r *CloudflaredDNSReconciler) applyChanges(
+	ctx context.Context, log logr.Logger, plan cloudflare.Plan,
+) ([]cloudflare.DNSRecord, error) {
+	if !r.BatchChanges {
+		return r.applyRecords(ctx, log, plan)
+	}
+	results, err := r.cloudflareClient(ctx).ApplyPlan(ctx, plan)
+	var applied cloudflare.Plan
+	for _, result := range results {
+		r.auditPlan(ctx, result.Plan, result.Created, result.Err)
+		if result.Err != nil {
+			continue
+		}
+		applied.Creates = append(applied.Creates, result.Plan.Creates...)
+		applied.Updates = append(applied.Updates, result.Plan.Updates...)
+		applied.Deletes = append(applied.Deletes, result.Plan.Deletes...)
+	}
+	metrics.RecordChanges.WithLabelValues("create", metrics.ResultSuccess).Add(float64(len(applied.Creates)))
+	metrics.RecordChanges.WithLabelValues("update", metrics.ResultSuccess).Add(float64(len(applied.Updates)))
+	metrics.RecordChanges.WithLabelValues("delete", metrics.ResultSuccess).Add(float64(len(applied.Deletes)))
+	if !applied.IsEmpty() {
+		log.Info("Applied DNS record batch",
+			"creates", len(applied.Creates), "updates", len(applied.Updates), "deletes", len(applied.Deletes))
+	}
+	switch {
+	case err == nil:
+		return applied.Deletes, nil
+	case errors.Is(err, cloudflare.ErrRateLimited), errors.Is(err, cloudflare.ErrUnauthorized), ctx.Err() != nil:
+		return applied.Deletes, err
+	}
+	log.Error(err, "DNS record batch failed, applying the remaining changes one by one")
+	deleted, err := r.applyRecords(ctx, log, unapplied(plan, applied))
+	return append(applied.Deletes, deleted...), err
+}
+
+// unapplied returns the changes of plan for hostnames that have no change in
+// applied. Batches never split a hostname's changes, so these are exactly the
+// changes that were not applied.
+func unapplied(plan, applied cloudflare.Plan) cloudflare.Plan {
+	done := map[string]bool{}
+	for _, recs := range [][]cloudflare.DNSRecord{applied.Creates, applied.Updates, applied.Deletes} {
+		for _, rec := range recs {
+			done[rec.Name] = true
+		}
+	}
+	isApplied := func(rec cloudflare.DNSRecord) bool { return done[rec.Name] }
+	return cloudflare.Plan{
+		Creates: slices.DeleteFunc(slices.Clone(plan.Creates), isApplied),
+		Updates: slices.DeleteFunc(slices.Clone(plan.Updates), isApplied),
+		Deletes: slices.DeleteFunc(slices.Clone(plan.Deletes), isApplied),
+	}
+}
+
+// operation is a single record call of a plan.
+type operation struct {
+	rec   cloudflare.DNSRecord
+	apply func(ctx context.Context, log logr.Logger, rec cloudflare.DNSRecord) error
+}
+
+// mergeMoves turns the create and delete of a hostname moving between tunnels
+// into an update of its existing record. Cloudflare rejects a second CNAME for
+// the same name, so creating the new record first would always fail.
+func mergeMoves(log logr.Logger, plan cloudflare.Plan) cloudflare.Plan {
+	deletes := make(map[string]int, len(plan.Deletes))
+	for i, rec := range plan.Deletes {
+		deletes[rec.Type+"/"+rec.Name] = i
+	}
+	moved := map[int]bool{}
+	creates := plan.Creates[:0:0]
+	for _, rec := range plan.Creates {
+		i, ok := deletes[rec.Type+"/"+rec.Name]
+		if !ok || moved[i] {
+			creates = append(creates, rec)
+			continue
+		}
+		log.Info("Moving DNS record to another tunnel", "hostname", rec.Name, "from", plan.Deletes[i].Content, "to", rec.Content)
+		moved[i] = true
+		rec.ID = plan.Deletes[i].ID
+		plan.Updates = append(plan.Updates, rec)
+	}
+	if len(moved) == 0 {
+		return plan
+	}
+	deleted := make([]cloudflare.DNSRecord, 0, len(plan.Deletes)-len(moved))
+	for i, rec := range plan.Deletes {
+		if !moved[i] {
+			deleted = append(deleted, rec)
+		}
+	}
+	plan.Creates, plan.Deletes = creates, deleted
+	return plan
+}
+
+// applyRecords applies plan one record at a time, running up to ApplyConcurrency
+// calls at once. Creates and updates finish before any delete starts, and the
+// record of a hostname whose create or update failed is not deleted. It returns
+// the deleted records. Errors are collected per hostname; a rate limit or
+// authorization failure stops scheduling further calls.
+func (r *CloudflaredDNSReconciler) applyRecords(
+	ctx context.Context, log logr.Logger, plan cloudflare.Plan,
+) ([]cloudflare.DNSRecord, error) {
+	var (
+		mu      sync.Mutex
+		errs    = map[string]error{}
+		deleted []cloudflare.DNSRecord
+		stopped atomic.Bool
+	)
+	run := func(ops []operation) {
+		var g errgroup.Group
+		g.SetLimit(r.applyConcurrency())
+		for _, op := range ops {
+			g.Go(func() error {
+				if stopped.Load() || ctx.Err() != nil {
+					return nil
+				}
+				err := op.apply(ctx, log, op.rec)
+				if err == nil {
+					return nil
+				}
+				if errors.Is(err, cloudflare.ErrRateLimited) || errors.Is(err, cloudflare.ErrUnauthorized) {
+					stopped.Store(true)
+				}
+				mu.Lock()
+				errs[op.rec.Name] = errors.Join(errs[op.rec.Name], err)
+				mu.Unlock()
+				return nil
+			})
+		}
+		_ = g.Wait()
+	}
+
+	upserts := make([]operation, 0, len(plan.Creates)+len(plan.Updates))
+	for _, rec := range plan.Creates {
+		upserts = append(upserts, operation{rec: rec, apply: r.createRecord})
+	}
+	for _, rec := range plan.Updates {
+		upserts = append(upserts, operation{rec: rec, apply: r.updateRecord})
+	}
+	run(upserts)
+
+	deletes := make([]operation, 0, len(plan.Deletes))
+	for _, rec := range plan.Deletes {
+		if _, failed := errs[rec.Name]; failed {
+			log.Info("Keeping DNS record until its replacement is in place", "hostname", rec.Name)
+			continue
+		}
+		deletes = append(deletes, operation{rec: rec, apply: func(ctx context.Context, log logr.Logger, rec cloudflare.DNSRecord) error {
+			if err := r.deleteRecord(ctx, log, rec); err != nil {
+				return err
+			}
+			mu.Lock()
+			deleted = append(deleted, rec)
+			mu.Unlock()
+			return nil
+		}})
+	}
+	run(deletes)
+
+	if err := ctx.Err(); err != nil {
+		return deleted, err
+	}
+	hostnames := slices.Sorted(maps.Keys(errs))
+	joined := make([]error, 0, len(hostnames))
+	for _, hostname := range hostnames {
+		joined = append(joined, fmt.Errorf("%s: %w", hostname, errs[hostname]))
+	}
+	return deleted, errors.Join(joined...)
+}
+
+// setPendingChanges reports plan as the changes of source that are not applied yet.
+func setPendingChanges(source string, plan cloudflare.Plan) {
+	metrics.PendingChanges.WithLabelValues(source, "create").Set(float64(len(plan.Creates)))
+	metrics.PendingChanges.WithLabelValues(source, "update").Set(float64(len(plan.Updates)))
+	metrics.PendingChanges.WithLabelValues(source, "delete").Set(float64(len(plan.Deletes)))
+}
+
+// tracePlan adds the tunnels and the size of plan to the reconcile span.
+func tracePlan(ctx context.Context, tunnels []string, plan cloudflare.Plan) {
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.StringSlice("cloudflared.tunnels", tunnels),
+		attribute.Int("plan.creates", len(plan.Creates)),
+		attribute.Int("plan.updates", len(plan.Updates)),
+		attribute.Int("plan.deletes", len(plan.Deletes)),
+	)
+}
+
+// notifyPlan reports an applied plan to the notifier, unless it was empty.
+func (r *CloudflaredDNSReconciler) notifyPlan(ctx context.Context, source string, tunnels []string, plan cloudflare.Plan) {
+	if plan.IsEmpty() {
+		return
+	}
+	applied := newAppliedPlan(plan)
+	r.Notifier.Applied(notify.Event{
+		Source:  source,
+		ZoneID:  r.zoneID(ctx),
+		Tunnels: tunnels,
+		Created: applied.Creates,
+		Updated: applied.Updates,
+		Deleted: applied.Deletes,
+	})
+}
+
+func (r *CloudflaredDNSReconciler) applyConcurrency() int {
+	if r.ApplyConcurrency < 1 {
+		return 1
+	}
+	return r.ApplyConcurrency
+}
+
+// createRecord creates rec. When Cloudflare reports the hostname is already taken,
+// a record with the same target is adopted and brought to the desired settings;
+// a record owned by anything else is left alone and the create fails.
+func (r *CloudflaredDNSReconciler) createRecord(ctx context.Context, log logr.Logger, rec cloudflare.DNSRecord) error {
+	log.Info("Creating DNS record", "hostname", rec.Name, "target", rec.Content)
+	err := r.adoptOrCreate(ctx, log, rec)
+	metrics.RecordChanges.WithLabelValues("create", metrics.Result(err)).Inc()
+	return err
+}
+
+func (r *CloudflaredDNSReconciler) adoptOrCreate(ctx context.Context, log logr.Logger, rec cloudflare.DNSRecord) error {
+	created, err := r.cloudflareClient(ctx).CreateDNSRecord(ctx, rec)
+	if !errors.Is(err, cloudflare.ErrAlreadyExists) {
+		if err == nil {
+			rec = created
+		}
+		r.audit(ctx, audit.ActionCreate, nil, &rec, err)
+		return err
+	}
+	existingRecords, err := r.refreshRecords(ctx)
+	if err != nil {
+		r.audit(ctx, audit.ActionCreate, nil, &rec, err)
+		return err
+	}
+	for _, existing := range existingRecords {
+		if existing.Name != rec.Name || existing.Type != rec.Type || existing.Content != rec.Content {
+			continue
+		}
+		log.Info("Adopting existing DNS record", "hostname", rec.Name)
+		if recordSettingsEqual(existing, rec) {
+			r.audit(ctx, audit.ActionAdopt, &existing, &existing, nil)
+			return nil
+		}
+		rec.ID = existing.ID
+		err := r.cloudflareClient(ctx).UpdateDNSRecord(ctx, rec)
+		r.audit(ctx, audit.ActionUpdate, &existing, &rec, err)
+		return err
+	}
+	err = fmt.Errorf("hostname is already used by another DNS record: %w", cloudflare.ErrAlreadyExists)
+	r.audit(ctx, audit.ActionCreate, nil, &rec, err)
+	return err
+}
+
+func (r *CloudflaredDNSReconciler) updateRecord(ctx context.Context, log logr.Logger, rec cloudflare.DNSRecord) error {
+	log.Info("Updating DNS record", "hostname", rec.Name, "proxied", rec.Proxied, "ttl", rec.TTL)
+	err := r.cloudflareClient(ctx).UpdateDNSRecord(ctx, rec)
+	r.audit(ctx, audit.ActionUpdate, nil, &rec, err)
+	metrics.RecordChanges.WithLabelValues("update", metrics.Result(err)).Inc()
+	return err
+}
+
+// deleteRecord deletes rec, treating a record that is already gone as deleted.
+func (r *CloudflaredDNSReconciler) deleteRecord(ctx context.Context, log logr.Logger, rec cloudflare.DNSRecord) error {
+	log.Info("Deleting DNS record", "hostname", rec.Name)
+	err := r.cloudflareClient(ctx).DeleteDNSRecord(ctx, rec.ID)
+	if errors.Is(err, cloudflare.ErrNotFound) {
+		log.Info("DNS record already deleted", "hostname", rec.Name)
+		err = nil
+	}
+	r.audit(ctx, audit.ActionDelete, &rec, nil, err)
+	metrics.RecordChanges.WithLabelValues("delete", metrics.Result(err)).Inc()
+	return err
+}
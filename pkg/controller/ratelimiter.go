@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// SetupOptions tunes the controller created by SetupWithManager.
+// Zero values keep the controller-runtime defaults.
+type SetupOptions struct {
+	MaxConcurrentReconciles int
+	RateLimiter             RateLimiterOptions
+}
+
+// RateLimiterOptions configures how failed reconciles are requeued: a per-item
+// exponential backoff between BaseDelay and MaxDelay, capped overall by a token
+// bucket of QPS and Burst.
+type RateLimiterOptions struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	QPS       float64
+	Burst     int
+}
+
+func (o RateLimiterOptions) isZero() bool {
+	return o == RateLimiterOptions{}
+}
+
+func NewRateLimiter(o RateLimiterOptions) workqueue.TypedRateLimiter[reconcile.Request] {
+	return workqueue.NewTypedMaxOfRateLimiter(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](o.BaseDelay, o.MaxDelay),
+		&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(o.QPS), o.Burst)},
+	)
+}
+
+// loggingRateLimiter logs the backoff chosen for every failed reconcile.
+type loggingRateLimiter struct {
+	workqueue.TypedRateLimiter[reconcile.Request]
+	log logr.Logger
+}
+
+func (l *loggingRateLimiter) When(req reconcile.Request) time.Duration {
+	delay := l.TypedRateLimiter.When(req)
+	l.log.Info("Requeueing failed reconcile with backoff",
+		"configmap", req.NamespacedName, "delay", delay, "failures", l.NumRequeues(req))
+	return delay
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+	"github.com/seipan/cloudflared-dns-controller/pkg/config"
+	"github.com/seipan/cloudflared-dns-controller/pkg/history"
+)
+
+const (
+	// desiredHashAnnotation holds a hash of the records the ConfigMap asked for
+	// when it was last synced successfully.
+	desiredHashAnnotation = "cloudflared-dns-controller.seipan.github.io/desired-hash"
+
+	// lastAppliedPlanAnnotation lists the hostnames changed by the last non-empty plan, as JSON.
+	lastAppliedPlanAnnotation = "cloudflared-dns-controller.seipan.github.io/last-applied-plan"
+)
+
+// desiredState is what desiredHashAnnotation is computed from.
+type desiredState struct {
+	Keys        map[string]string                 `json:"keys"`
+	Records     map[string][]cloudflare.DNSRecord `json:"records"`
+	Credentials string                            `json:"credentials,omitempty"`
+	Restore     string                            `json:"restore,omitempty"`
+	Approved    string                            `json:"approved,omitempty"`
+}
+
+// appliedPlan is the value of lastAppliedPlanAnnotation.
+type appliedPlan struct {
+	Creates []string `json:"creates,omitempty"`
+	Updates []string `json:"updates,omitempty"`
+	Deletes []string `json:"deletes,omitempty"`
+}
+
+func newAppliedPlan(plan cloudflare.Plan) appliedPlan {
+	names := func(recs []cloudflare.DNSRecord) []string {
+		var result []string
+		for _, rec := range recs {
+			result = append(result, rec.Name)
+		}
+		return result
+	}
+	return appliedPlan{Creates: names(plan.Creates), Updates: names(plan.Updates), Deletes: names(plan.Deletes)}
+}
+
+// hashDesiredState hashes the parsed desired state, so reformatting a config
+// or touching unrelated metadata leaves the hash unchanged.
+func (r *CloudflaredDNSReconciler) hashDesiredState(
+	cm *corev1.ConfigMap, sources []source, overrides map[string]config.DNSSettings,
+) string {
+	state := desiredState{
+		Keys:        map[string]string{},
+		Records:     map[string][]cloudflare.DNSRecord{},
+		Credentials: cm.Annotations[credentialsSecretAnnotation],
+		Restore:     cm.Annotations[history.RestoreAnnotation],
+		Approved:    cm.Annotations[approvedPlanAnnotation],
+	}
+	for _, src := range sources {
+		state.Keys[src.key] = src.cfg.Tunnel
+	}
+	for _, tunnel := range tunnels(sources) {
+		state.Records[tunnel] = r.desiredRecords(sources, tunnel, overrides)
+	}
+	// Maps are marshaled with sorted keys and records are built in key order.
+	data, _ := json.Marshal(state)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *CloudflaredDNSReconciler) desiredHash(cm *corev1.ConfigMap) (string, error) {
+	sources, err := parseSources(cm, config.FindKeys(cm.Data, r.targetKeys()))
+	if err != nil {
+		return "", err
+	}
+	overrides, err := dnsOverrides(cm)
+	if err != nil {
+		return "", err
+	}
+	return r.hashDesiredState(cm, sources, overrides), nil
+}
+
+// setState records the synced desired state and, if anything was changed, the
+// applied plan. It reports whether the annotations changed.
+func setState(cm *corev1.ConfigMap, hash string, plan cloudflare.Plan) (bool, error) {
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	changed := cm.Annotations[desiredHashAnnotation] != hash
+	cm.Annotations[desiredHashAnnotation] = hash
+	if plan.IsEmpty() {
+		return changed, nil
+	}
+	v, err := json.Marshal(newAppliedPlan(plan))
+	if err != nil {
+		return changed, err
+	}
+	changed = changed || cm.Annotations[lastAppliedPlanAnnotation] != string(v)
+	cm.Annotations[lastAppliedPlanAnnotation] = string(v)
+	return changed, nil
+}
+
+// contentChangedPredicate drops updates that change neither the target keys,
+// the DNS overrides, the credentials Secret, the restored hostnames, the plan
+// approval nor the deletion state, such as the controller's own finalizer and
+// annotation writes, and updates whose parsed desired state matches what was
+// last synced. Periodic resyncs are requeues, not events, so they still run.
+func (r *CloudflaredDNSReconciler) contentChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldCM, ok := e.ObjectOld.(*corev1.ConfigMap)
+			if !ok {
+				return true
+			}
+			newCM, ok := e.ObjectNew.(*corev1.ConfigMap)
+			if !ok {
+				return true
+			}
+			if !newCM.DeletionTimestamp.IsZero() {
+				return true
+			}
+			if maps.Equal(r.targetData(oldCM), r.targetData(newCM)) &&
+				oldCM.Annotations[dnsOverridesAnnotation] == newCM.Annotations[dnsOverridesAnnotation] &&
+				oldCM.Annotations[credentialsSecretAnnotation] == newCM.Annotations[credentialsSecretAnnotation] &&
+				oldCM.Annotations[history.RestoreAnnotation] == newCM.Annotations[history.RestoreAnnotation] &&
+				oldCM.Annotations[approvedPlanAnnotation] == newCM.Annotations[approvedPlanAnnotation] {
+				return false
+			}
+			hash, err := r.desiredHash(newCM)
+			if err != nil {
+				// Let the reconcile surface the error.
+				return true
+			}
+			return hash != newCM.Annotations[desiredHashAnnotation]
+		},
+	}
+}
+
+// targetData returns the target keys of cm and their content.
+func (r *CloudflaredDNSReconciler) targetData(cm *corev1.ConfigMap) map[string]string {
+	data := map[string]string{}
+	for _, key := range config.FindKeys(cm.Data, r.targetKeys()) {
+		data[key] = cm.Data[key]
+	}
+	return data
+}
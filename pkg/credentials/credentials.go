@@ -0,0 +1,179 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+)
+
+// Auth modes selecting which Credentials authenticate the client.
+const (
+	AuthModeToken  = "token"
+	AuthModeAPIKey = "apiKey"
+)
+
+// Credentials authenticate the controller against one Cloudflare zone, either
+// with an API token or with a Global API Key and its account email.
+type Credentials struct {
+	APIToken string
+	APIKey   string
+	APIEmail string
+	ZoneID   string
+}
+
+// Options returns the client options for the Global API Key, if set.
+func (c Credentials) Options() []cloudflare.Option {
+	if c.APIKey == "" {
+		return nil
+	}
+	return []cloudflare.Option{cloudflare.WithAPIKey(c.APIEmail, c.APIKey)}
+}
+
+// Source reads Credentials from files, such as a mounted Secret, falling back
+// to the literal values when a file is not set. AuthMode defaults to
+// AuthModeToken; the Global API Key is only read from the literal values.
+type Source struct {
+	AuthMode     string
+	APITokenFile string
+	ZoneIDFile   string
+	APIToken     string
+	APIKey       string
+	APIEmail     string
+	ZoneID       string
+}
+
+// Files reports whether any credential is read from a file.
+func (s Source) Files() bool {
+	return s.APITokenFile != "" || s.ZoneIDFile != ""
+}
+
+func (s Source) Load() (Credentials, error) {
+	creds := Credentials{ZoneID: s.ZoneID}
+	var err error
+	switch s.AuthMode {
+	case "", AuthModeToken:
+		creds.APIToken = s.APIToken
+		if s.APITokenFile != "" {
+			if creds.APIToken, err = readFile(s.APITokenFile); err != nil {
+				return Credentials{}, err
+			}
+		}
+		if creds.APIToken == "" {
+			return Credentials{}, errors.New("API token must be set")
+		}
+	case AuthModeAPIKey:
+		creds.APIKey, creds.APIEmail = s.APIKey, s.APIEmail
+		if creds.APIKey == "" || creds.APIEmail == "" {
+			return Credentials{}, errors.New("API key and email must both be set")
+		}
+	default:
+		return Credentials{}, fmt.Errorf("unknown auth mode %q", s.AuthMode)
+	}
+	if s.ZoneIDFile != "" {
+		if creds.ZoneID, err = readFile(s.ZoneIDFile); err != nil {
+			return Credentials{}, err
+		}
+	}
+	if creds.ZoneID == "" {
+		return Credentials{}, errors.New("zone ID must be set")
+	}
+	return creds, nil
+}
+
+func readFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Watcher reloads a Source whenever its files change and passes changed
+// credentials to onChange.
+type Watcher struct {
+	source   Source
+	current  Credentials
+	onChange func(Credentials)
+	log      logr.Logger
+	// debounce groups the burst of events of one Secret update.
+	debounce time.Duration
+}
+
+func NewWatcher(source Source, current Credentials, onChange func(Credentials), log logr.Logger) *Watcher {
+	return &Watcher{
+		source:   source,
+		current:  current,
+		onChange: onChange,
+		log:      log,
+		debounce: time.Second,
+	}
+}
+
+// Start watches the directories of the credential files until ctx is done.
+// Directories are watched rather than files because Kubernetes updates
+// mounted Secrets by swapping a symlink. It implements manager.Runnable.
+func (w *Watcher) Start(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = watcher.Close() }()
+	for _, file := range []string{w.source.APITokenFile, w.source.ZoneIDFile} {
+		if file == "" {
+			continue
+		}
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", file, err)
+		}
+	}
+
+	timer := time.NewTimer(0)
+	<-timer.C
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			timer.Reset(w.debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.log.Error(err, "error watching credential files")
+		case <-timer.C:
+			w.reload()
+		}
+	}
+}
+
+// NeedLeaderElection reports false so every replica keeps fresh credentials.
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+func (w *Watcher) reload() {
+	creds, err := w.source.Load()
+	if err != nil {
+		w.log.Error(err, "unable to reload credentials, keeping the current ones")
+		return
+	}
+	if creds == w.current {
+		return
+	}
+	w.current = creds
+	w.log.Info("Credentials changed, replacing the Cloudflare client", "zoneID", creds.ZoneID)
+	w.onChange(creds)
+}
@@ -0,0 +1,102 @@
+package credentials
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestSourceLoad(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "api-token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := Source{APITokenFile: tokenFile, APIToken: "env-token", ZoneID: "zone"}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Credentials{APIToken: "file-token", ZoneID: "zone"}); creds != want {
+		t.Errorf("Load() = %+v, want %+v", creds, want)
+	}
+
+	if _, err := (Source{APIToken: "token"}).Load(); err == nil {
+		t.Error("Load() without a zone ID should fail")
+	}
+	if _, err := (Source{ZoneIDFile: filepath.Join(dir, "missing"), APIToken: "token"}).Load(); err == nil {
+		t.Error("Load() with a missing file should fail")
+	}
+}
+
+func TestSourceLoadAPIKey(t *testing.T) {
+	creds, err := Source{
+		AuthMode: AuthModeAPIKey,
+		APIToken: "ignored",
+		APIKey:   "key",
+		APIEmail: "admin@example.com",
+		ZoneID:   "zone",
+	}.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Credentials{APIKey: "key", APIEmail: "admin@example.com", ZoneID: "zone"}); creds != want {
+		t.Errorf("Load() = %+v, want %+v", creds, want)
+	}
+	if len(creds.Options()) != 1 {
+		t.Errorf("Options() = %d options, want 1", len(creds.Options()))
+	}
+
+	if _, err := (Source{AuthMode: AuthModeAPIKey, APIKey: "key", ZoneID: "zone"}).Load(); err == nil {
+		t.Error("Load() without an email should fail")
+	}
+	if _, err := (Source{AuthMode: "basic", APIToken: "token", ZoneID: "zone"}).Load(); err == nil {
+		t.Error("Load() with an unknown auth mode should fail")
+	}
+}
+
+func TestWatcherReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "api-token")
+	if err := os.WriteFile(tokenFile, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	source := Source{APITokenFile: tokenFile, ZoneID: "zone"}
+	current, err := source.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan Credentials, 1)
+	w := NewWatcher(source, current, func(creds Credentials) { changed <- creds }, logr.Discard())
+	w.debounce = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- w.Start(ctx) }()
+
+	// Give the watcher time to register before writing.
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(tokenFile, []byte("new"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case creds := <-changed:
+		if creds.APIToken != "new" {
+			t.Errorf("reloaded token = %q, want %q", creds.APIToken, "new")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("credentials were not reloaded")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Start() = %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+)
+
+// Keys read from a credentials Secret, matching the Helm chart's Secret.
+const (
+	SecretAPITokenKey = "api-token"
+	SecretAPIKeyKey   = "api-key"
+	SecretEmailKey    = "email"
+	SecretZoneIDKey   = "zone-id"
+)
+
+// FromSecret reads Credentials from the api-token and zone-id keys of secret.
+// Without api-token, the Global API Key is read from api-key and email.
+func FromSecret(secret *corev1.Secret) (Credentials, error) {
+	creds := Credentials{
+		APIToken: string(secret.Data[SecretAPITokenKey]),
+		ZoneID:   string(secret.Data[SecretZoneIDKey]),
+	}
+	var errs []error
+	if creds.APIToken == "" {
+		creds.APIKey = string(secret.Data[SecretAPIKeyKey])
+		creds.APIEmail = string(secret.Data[SecretEmailKey])
+		if creds.APIKey == "" || creds.APIEmail == "" {
+			errs = append(errs, fmt.Errorf("key %s, or %s and %s, must be set", SecretAPITokenKey, SecretAPIKeyKey, SecretEmailKey))
+		}
+	}
+	if creds.ZoneID == "" {
+		errs = append(errs, fmt.Errorf("key %s is empty", SecretZoneIDKey))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Credentials{}, fmt.Errorf("secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return creds, nil
+}
+
+// Pool shares one cloudflare.Client, with its record cache and rate limiter,
+// between every source using the same credentials. Clients unused for idleTTL
+// are dropped, so rotated tokens do not stay in memory.
+type Pool struct {
+	newClient func(Credentials) cloudflare.Client
+	idleTTL   time.Duration
+
+	mu      sync.Mutex
+	clients map[Credentials]*pooledClient
+	// sources holds the credentials each source last used, so its records can
+	// still be cleaned up once its Secret is gone.
+	sources map[string]Credentials
+}
+
+type pooledClient struct {
+	client   cloudflare.Client
+	lastUsed time.Time
+}
+
+func NewPool(newClient func(Credentials) cloudflare.Client) *Pool {
+	return &Pool{
+		newClient: newClient,
+		idleTTL:   time.Hour,
+		clients:   map[Credentials]*pooledClient{},
+		sources:   map[string]Credentials{},
+	}
+}
+
+// Get returns the client for creds, creating it on first use, and remembers
+// creds as the credentials of source.
+func (p *Pool) Get(source string, creds Credentials) cloudflare.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sources[source] = creds
+	return p.get(creds)
+}
+
+// Last returns the client and credentials source last used.
+func (p *Pool) Last(source string) (cloudflare.Client, Credentials, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	creds, ok := p.sources[source]
+	if !ok {
+		return nil, Credentials{}, false
+	}
+	return p.get(creds), creds, true
+}
+
+// Forget drops the credentials remembered for source.
+func (p *Pool) Forget(source string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sources, source)
+}
+
+func (p *Pool) get(creds Credentials) cloudflare.Client {
+	now := time.Now()
+	for key, pooled := range p.clients {
+		if key != creds && now.Sub(pooled.lastUsed) > p.idleTTL {
+			delete(p.clients, key)
+		}
+	}
+	pooled, ok := p.clients[creds]
+	if !ok {
+		pooled = &pooledClient{client: p.newClient(creds)}
+		p.clients[creds] = pooled
+	}
+	pooled.lastUsed = now
+	return pooled.client
+}
+
+// Len returns the number of pooled clients.
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.clients)
+}
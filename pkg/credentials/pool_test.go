@@ -0,0 +1,74 @@
+package credentials
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+)
+
+func TestPool(t *testing.T) {
+	created := 0
+	p := NewPool(func(creds Credentials) cloudflare.Client {
+		created++
+		return cloudflare.NewClient(creds.APIToken, creds.ZoneID)
+	})
+
+	a := Credentials{APIToken: "a", ZoneID: "zone-a"}
+	b := Credentials{APIToken: "b", ZoneID: "zone-b"}
+	if p.Get("ns/a", a) != p.Get("ns/other", a) {
+		t.Error("Get() should reuse the client of the same credentials")
+	}
+	if p.Get("ns/a", a) == p.Get("ns/b", b) {
+		t.Error("Get() should not share clients between credentials")
+	}
+	if created != 2 {
+		t.Errorf("created %d clients, want 2", created)
+	}
+
+	p.idleTTL = 0
+	time.Sleep(time.Millisecond)
+	p.Get("ns/b", b)
+	if p.Len() != 1 {
+		t.Errorf("pool holds %d clients after eviction, want 1", p.Len())
+	}
+
+	if c, creds, ok := p.Last("ns/a"); !ok || creds != a || c == nil {
+		t.Errorf("Last() = %v, %+v, %v, want the client of %+v", c, creds, ok, a)
+	}
+	p.Forget("ns/a")
+	if _, _, ok := p.Last("ns/a"); ok {
+		t.Error("Last() should not return forgotten credentials")
+	}
+}
+
+func TestFromSecret(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cf", Namespace: "ns"},
+		Data:       map[string][]byte{SecretAPITokenKey: []byte("token"), SecretZoneIDKey: []byte("zone")},
+	}
+	creds, err := FromSecret(secret)
+	if err != nil || creds != (Credentials{APIToken: "token", ZoneID: "zone"}) {
+		t.Errorf("FromSecret() = %+v, %v", creds, err)
+	}
+
+	delete(secret.Data, SecretZoneIDKey)
+	if _, err := FromSecret(secret); err == nil {
+		t.Error("FromSecret() without a zone ID should fail")
+	}
+
+	secret.Data = map[string][]byte{
+		SecretAPIKeyKey: []byte("key"), SecretEmailKey: []byte("admin@example.com"), SecretZoneIDKey: []byte("zone"),
+	}
+	creds, err = FromSecret(secret)
+	if err != nil || creds != (Credentials{APIKey: "key", APIEmail: "admin@example.com", ZoneID: "zone"}) {
+		t.Errorf("FromSecret() = %+v, %v", creds, err)
+	}
+	delete(secret.Data, SecretEmailKey)
+	if _, err := FromSecret(secret); err == nil {
+		t.Error("FromSecret() with an API key but no email should fail")
+	}
+}
@@ -0,0 +1,96 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+	"github.com/seipan/cloudflared-dns-controller/pkg/metrics"
+)
+
+var errNotChecked = errors.New("cloudflare access has not been checked yet")
+
+// CloudflareChecker verifies the Cloudflare credentials at startup and every
+// interval, and serves the cached result to readiness probes so probes never
+// call the API themselves.
+type CloudflareChecker struct {
+	verifier cloudflare.Verifier
+	interval time.Duration
+	timeout  time.Duration
+	log      logr.Logger
+
+	mu  sync.RWMutex
+	err error
+}
+
+func NewCloudflareChecker(verifier cloudflare.Verifier, interval time.Duration, log logr.Logger) *CloudflareChecker {
+	return &CloudflareChecker{
+		verifier: verifier,
+		interval: interval,
+		timeout:  30 * time.Second,
+		log:      log,
+		err:      errNotChecked,
+	}
+}
+
+// Start runs the checks until ctx is done. It implements manager.Runnable.
+func (c *CloudflareChecker) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.check(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection reports false so every replica checks its own credentials.
+func (c *CloudflareChecker) NeedLeaderElection() bool {
+	return false
+}
+
+// Check returns the result of the last check. It is a healthz.Checker.
+func (c *CloudflareChecker) Check(_ *http.Request) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.err
+}
+
+func (c *CloudflareChecker) check(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	err := c.verifier.VerifyAccess(ctx)
+	if err != nil && ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// Shutting down.
+		return
+	}
+
+	c.mu.Lock()
+	prev := c.err
+	c.err = err
+	c.mu.Unlock()
+
+	if err != nil {
+		reason := "error"
+		var accessErr *cloudflare.AccessError
+		if errors.As(err, &accessErr) {
+			reason = accessErr.Reason
+		}
+		metrics.CloudflareAccess.Set(0)
+		metrics.CloudflareAccessFailures.WithLabelValues(reason).Inc()
+		c.log.Error(err, "Cloudflare access check failed", "reason", reason)
+		return
+	}
+	metrics.CloudflareAccess.Set(1)
+	if prev != nil {
+		c.log.Info("Cloudflare access check succeeded")
+	}
+}
@@ -0,0 +1,64 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+	"github.com/seipan/cloudflared-dns-controller/pkg/metrics"
+)
+
+type fakeVerifier struct {
+	calls int
+	err   error
+}
+
+func (f *fakeVerifier) VerifyAccess(_ context.Context) error {
+	f.calls++
+	return f.err
+}
+
+func TestCloudflareChecker(t *testing.T) {
+	verifier := &fakeVerifier{
+		err: &cloudflare.AccessError{Reason: cloudflare.AccessReasonToken, Err: errors.New("revoked")},
+	}
+	c := NewCloudflareChecker(verifier, time.Hour, logr.Discard())
+
+	if err := c.Check(nil); !errors.Is(err, errNotChecked) {
+		t.Fatalf("Check() before the first check = %v, want %v", err, errNotChecked)
+	}
+
+	c.check(context.Background())
+	var accessErr *cloudflare.AccessError
+	if err := c.Check(nil); !errors.As(err, &accessErr) || accessErr.Reason != cloudflare.AccessReasonToken {
+		t.Errorf("Check() = %v, want a token AccessError", err)
+	}
+	if got := testutil.ToFloat64(metrics.CloudflareAccess); got != 0 {
+		t.Errorf("access_ok = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(metrics.CloudflareAccessFailures.WithLabelValues(cloudflare.AccessReasonToken)); got != 1 {
+		t.Errorf("token failures = %v, want 1", got)
+	}
+
+	verifier.err = nil
+	c.check(context.Background())
+	if err := c.Check(nil); err != nil {
+		t.Errorf("Check() = %v, want nil", err)
+	}
+	if got := testutil.ToFloat64(metrics.CloudflareAccess); got != 1 {
+		t.Errorf("access_ok = %v, want 1", got)
+	}
+
+	// Probes only read the cached result.
+	for range 10 {
+		_ = c.Check(nil)
+	}
+	if got := verifier.calls; got != 2 {
+		t.Errorf("VerifyAccess called %d times, want 2", got)
+	}
+}
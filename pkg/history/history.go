@@ -0,0 +1,160 @@
+// Package history keeps snapshots of deleted DNS records in a ConfigMap, so
+// they can be restored after an accidental change.
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+)
+
+// RestoreAnnotation lists hostnames, comma-separated, on a source ConfigMap
+// whose last deleted record the controller restores. Restored records are kept
+// until the ingress asks for the hostname again, which drops it from the
+// annotation, or until the hostname is removed from the annotation.
+const RestoreAnnotation = "cloudflared-dns-controller.seipan.github.io/restore"
+
+// DataKey is the ConfigMap key holding the entries as a JSON array, oldest first.
+const DataKey = "history.json"
+
+// Entry is a snapshot of a record deleted by a source ConfigMap.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`
+	ZoneID  string    `json:"zoneID"`
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Content string    `json:"content"`
+	Proxied bool      `json:"proxied"`
+	TTL     int       `json:"ttl"`
+	Comment string    `json:"comment,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+}
+
+func NewEntry(t time.Time, source, zoneID string, rec cloudflare.DNSRecord) Entry {
+	return Entry{
+		Time:    t,
+		Source:  source,
+		ZoneID:  zoneID,
+		Name:    rec.Name,
+		Type:    rec.Type,
+		Content: rec.Content,
+		Proxied: rec.Proxied,
+		TTL:     rec.TTL,
+		Comment: rec.Comment,
+		Tags:    rec.Tags,
+	}
+}
+
+// Record returns the record to create to restore the entry.
+func (e Entry) Record() cloudflare.DNSRecord {
+	return cloudflare.DNSRecord{
+		Name:    e.Name,
+		Type:    e.Type,
+		Content: e.Content,
+		Proxied: e.Proxied,
+		TTL:     e.TTL,
+		Comment: e.Comment,
+		Tags:    e.Tags,
+	}
+}
+
+// Latest returns the newest entry of hostname deleted by source.
+func Latest(entries []Entry, source, hostname string) (Entry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Source == source && entries[i].Name == hostname {
+			return entries[i], true
+		}
+	}
+	return Entry{}, false
+}
+
+// Store reads and appends entries of the ConfigMap key, keeping the newest limit.
+type Store struct {
+	client client.Client
+	key    types.NamespacedName
+	limit  int
+}
+
+func NewStore(c client.Client, key types.NamespacedName, limit int) *Store {
+	return &Store{client: c, key: key, limit: limit}
+}
+
+// List returns the entries, oldest first. A missing ConfigMap has none.
+func (s *Store) List(ctx context.Context) ([]Entry, error) {
+	cm := &corev1.ConfigMap{}
+	if err := s.client.Get(ctx, s.key, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read history %s: %w", s.key, err)
+	}
+	return decode(cm)
+}
+
+// Append adds entries, creating the ConfigMap if needed and dropping the
+// oldest entries beyond the limit.
+func (s *Store) Append(ctx context.Context, entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	conflict := func(err error) bool { return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) }
+	err := retry.OnError(retry.DefaultRetry, conflict, func() error {
+		cm := &corev1.ConfigMap{}
+		err := s.client.Get(ctx, s.key, cm)
+		create := apierrors.IsNotFound(err)
+		if err != nil && !create {
+			return err
+		}
+		existing, err := decode(cm)
+		if err != nil {
+			return err
+		}
+		all := append(existing, entries...)
+		if len(all) > s.limit {
+			all = all[len(all)-s.limit:]
+		}
+		data, err := json.Marshal(all)
+		if err != nil {
+			return err
+		}
+		if create {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: s.key.Name, Namespace: s.key.Namespace},
+				Data:       map[string]string{DataKey: string(data)},
+			}
+			return s.client.Create(ctx, cm)
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[DataKey] = string(data)
+		return s.client.Update(ctx, cm)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write history %s: %w", s.key, err)
+	}
+	return nil
+}
+
+func decode(cm *corev1.ConfigMap) ([]Entry, error) {
+	data, ok := cm.Data[DataKey]
+	if !ok {
+		return nil, nil
+	}
+	var entries []Entry
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		return nil, fmt.Errorf("invalid history %s/%s: %w", cm.Namespace, cm.Name, err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,60 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/seipan/cloudflared-dns-controller/pkg/cloudflare"
+)
+
+func TestStoreAppend(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore(fake.NewClientBuilder().Build(), types.NamespacedName{Namespace: "ns", Name: "history"}, 3)
+
+	entries, err := store.List(ctx)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("List() = %v, %v, want no entries", entries, err)
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 4 {
+		rec := cloudflare.DNSRecord{ID: "id", Name: fmt.Sprintf("host%d.example.com", i), Type: "CNAME", Content: "t.cfargotunnel.com"}
+		if err := store.Append(ctx, NewEntry(start.Add(time.Duration(i)*time.Minute), "ns/cm", "zone", rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err = store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if fmt.Sprint(names) != "[host1.example.com host2.example.com host3.example.com]" {
+		t.Errorf("names = %v, want the 3 newest", names)
+	}
+	if rec := entries[0].Record(); rec.ID != "" || rec.Content != "t.cfargotunnel.com" {
+		t.Errorf("Record() = %+v", rec)
+	}
+}
+
+func TestLatest(t *testing.T) {
+	entries := []Entry{
+		{Source: "ns/a", Name: "x.example.com", Content: "old"},
+		{Source: "ns/b", Name: "x.example.com", Content: "other"},
+		{Source: "ns/a", Name: "x.example.com", Content: "new"},
+	}
+	if e, ok := Latest(entries, "ns/a", "x.example.com"); !ok || e.Content != "new" {
+		t.Errorf("Latest() = %+v, %v", e, ok)
+	}
+	if _, ok := Latest(entries, "ns/a", "y.example.com"); ok {
+		t.Error("Latest() found a hostname without entries")
+	}
+}
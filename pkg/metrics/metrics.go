@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "cloudflared_dns_controller"
+
+// Results of a record change.
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+var (
+	// CloudflareRateLimiterWait observes how long API calls waited for the client-side rate limiter.
+	CloudflareRateLimiterWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "cloudflare",
+		Name:      "ratelimiter_wait_seconds",
+		Help:      "Time Cloudflare API calls spent waiting for the client-side rate limiter.",
+		Buckets:   []float64{0.001, 0.01, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	})
+
+	// CloudflareRequests counts Cloudflare API requests, including retries.
+	CloudflareRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cloudflare",
+		Name:      "requests_total",
+		Help:      "Cloudflare API requests by operation and HTTP status code.",
+	}, []string{"operation", "code"})
+
+	// CloudflareRequestDuration observes the latency of Cloudflare API requests.
+	CloudflareRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "cloudflare",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of Cloudflare API requests by operation and HTTP status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "code"})
+
+	// CloudflareAccess is 1 while the last credentials check succeeded.
+	CloudflareAccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "cloudflare",
+		Name:      "access_ok",
+		Help:      "Whether the last check of the Cloudflare token and zone access succeeded.",
+	})
+
+	// CloudflareAccessFailures counts failed credentials checks by the step that failed.
+	CloudflareAccessFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cloudflare",
+		Name:      "access_check_failures_total",
+		Help:      "Failed checks of the Cloudflare token and zone access, by reason.",
+	}, []string{"reason"})
+
+	// ManagedRecords is the number of records each source ConfigMap wants in a zone for a tunnel.
+	ManagedRecords = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "managed_records",
+		Help:      "DNS records managed for a source ConfigMap, by zone and tunnel.",
+	}, []string{"zone", "tunnel", "source"})
+
+	// PendingChanges is the size of the plan computed by the last reconcile that has not been applied yet.
+	PendingChanges = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_changes",
+		Help:      "Record changes planned for a source ConfigMap that are not applied yet, by action.",
+	}, []string{"source", "action"})
+
+	// PendingDeletion is when each hostname waiting out the deletion grace period was found removed.
+	PendingDeletion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_deletion_timestamp_seconds",
+		Help:      "Unix time a hostname waiting for the deletion grace period was removed from a source ConfigMap.",
+	}, []string{"source", "hostname"})
+
+	// RecordChanges counts record creates, updates and deletes.
+	RecordChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "record_changes_total",
+		Help:      "DNS record changes by action and result.",
+	}, []string{"action", "result"})
+
+	// LastSuccessfulSync is when each source ConfigMap was last synced without errors.
+	LastSuccessfulSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_successful_sync_timestamp_seconds",
+		Help:      "Unix time of the last successful sync of a source ConfigMap.",
+	}, []string{"source"})
+)
+
+// Result returns the result label for err.
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultSuccess
+}
+
+// DeleteSource drops every series of source, once its ConfigMap is gone.
+func DeleteSource(source string) {
+	ManagedRecords.DeletePartialMatch(prometheus.Labels{"source": source})
+	PendingChanges.DeletePartialMatch(prometheus.Labels{"source": source})
+	PendingDeletion.DeletePartialMatch(prometheus.Labels{"source": source})
+	LastSuccessfulSync.DeletePartialMatch(prometheus.Labels{"source": source})
+}
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		CloudflareRateLimiterWait,
+		CloudflareRequests,
+		CloudflareRequestDuration,
+		CloudflareAccess,
+		CloudflareAccessFailures,
+		ManagedRecords,
+		PendingChanges,
+		PendingDeletion,
+		RecordChanges,
+		LastSuccessfulSync,
+	)
+}
@@ -0,0 +1,217 @@
+// Package notify posts DNS changes and persistent reconcile failures to chat
+// and other webhooks.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Kinds of an Event.
+const (
+	KindApplied = "applied"
+	KindFailed  = "failed"
+)
+
+// Event is an applied plan or a persistent failure of one source.
+type Event struct {
+	Kind     string    `json:"kind"`
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`
+	ZoneID   string    `json:"zoneID,omitempty"`
+	Tunnels  []string  `json:"tunnels,omitempty"`
+	Created  []string  `json:"created,omitempty"`
+	Updated  []string  `json:"updated,omitempty"`
+	Deleted  []string  `json:"deleted,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Failures int       `json:"failures,omitempty"` // consecutive failed reconciles
+}
+
+// Summary is a one-line description of the event.
+func (e Event) Summary() string {
+	if e.Kind == KindFailed {
+		return fmt.Sprintf("%s failed %d times in a row: %s", e.Source, e.Failures, e.Error)
+	}
+	var parts []string
+	for _, change := range []struct {
+		verb  string
+		names []string
+	}{
+		{"created", e.Created},
+		{"updated", e.Updated},
+		{"deleted", e.Deleted},
+	} {
+		if len(change.names) > 0 {
+			parts = append(parts, change.verb+" "+strings.Join(change.names, ", "))
+		}
+	}
+	return fmt.Sprintf("%s: %s", e.Source, strings.Join(parts, "; "))
+}
+
+// key identifies events that are duplicates of each other.
+func (e Event) key() string {
+	return strings.Join([]string{
+		e.Kind, e.Source, e.Error,
+		strings.Join(e.Created, ","), strings.Join(e.Updated, ","), strings.Join(e.Deleted, ","),
+	}, "\x00")
+}
+
+// Options tune a Notifier. Zero values use the defaults.
+type Options struct {
+	// FailureThreshold is how many reconciles of a source must fail in a row
+	// before it is reported. Defaults to 3.
+	FailureThreshold int
+	// DedupWindow suppresses an event identical to one sent within it. 0
+	// sends every event.
+	DedupWindow time.Duration
+	// MaxAttempts is how often a webhook is tried. Defaults to 3.
+	MaxAttempts int
+	// RetryDelay is the delay before the first retry, doubled for each
+	// further one. Defaults to 1 second.
+	RetryDelay time.Duration
+	// QueueSize is how many events wait to be sent before new ones are
+	// dropped. Defaults to 100.
+	QueueSize int
+}
+
+// Notifier queues events from reconciles and sends them to its webhooks in
+// the background. A nil Notifier discards events.
+type Notifier struct {
+	webhooks []Webhook
+	opts     Options
+	log      logr.Logger
+	events   chan Event
+
+	mu       sync.Mutex
+	failures map[string]int
+	sent     map[string]time.Time
+	now      func() time.Time
+}
+
+func New(webhooks []Webhook, opts Options, log logr.Logger) *Notifier {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 3
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+	return &Notifier{
+		webhooks: webhooks,
+		opts:     opts,
+		log:      log,
+		events:   make(chan Event, opts.QueueSize),
+		failures: make(map[string]int),
+		sent:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Applied reports a plan applied to a source.
+func (n *Notifier) Applied(ev Event) {
+	if n == nil {
+		return
+	}
+	ev.Kind = KindApplied
+	n.enqueue(ev)
+}
+
+// Failed counts a failed reconcile of source and reports it once
+// FailureThreshold reconciles failed in a row.
+func (n *Notifier) Failed(source string, err error) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	n.failures[source]++
+	failures := n.failures[source]
+	n.mu.Unlock()
+	if failures < n.opts.FailureThreshold {
+		return
+	}
+	n.enqueue(Event{Kind: KindFailed, Source: source, Error: err.Error(), Failures: failures})
+}
+
+// Succeeded resets the failure count of source.
+func (n *Notifier) Succeeded(source string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	delete(n.failures, source)
+	n.mu.Unlock()
+}
+
+func (n *Notifier) enqueue(ev Event) {
+	now := n.now()
+	if ev.Time.IsZero() {
+		ev.Time = now
+	}
+	key := ev.key()
+	n.mu.Lock()
+	for k, at := range n.sent {
+		if now.Sub(at) >= n.opts.DedupWindow {
+			delete(n.sent, k)
+		}
+	}
+	_, duplicate := n.sent[key]
+	if !duplicate && n.opts.DedupWindow > 0 {
+		n.sent[key] = now
+	}
+	n.mu.Unlock()
+	if duplicate {
+		return
+	}
+	select {
+	case n.events <- ev:
+	default:
+		n.log.Info("Notification queue is full, dropping event", "kind", ev.Kind, "source", ev.Source)
+	}
+}
+
+// Start sends queued events until ctx is done. It implements manager.Runnable.
+func (n *Notifier) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev := <-n.events:
+			for _, hook := range n.webhooks {
+				if err := n.send(ctx, hook, ev); err != nil && ctx.Err() == nil {
+					n.log.Error(err, "unable to send notification", "webhook", hook.Name(), "kind", ev.Kind, "source", ev.Source)
+				}
+			}
+		}
+	}
+}
+
+// send posts ev to hook, retrying network errors, 429s and 5xx responses.
+func (n *Notifier) send(ctx context.Context, hook Webhook, ev Event) error {
+	body, err := hook.Render(ev)
+	if err != nil {
+		return err
+	}
+	delay := n.opts.RetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := hook.post(ctx, body)
+		if err == nil || !retry || attempt == n.opts.MaxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// receiver records the payloads posted to it, answering with statuses in
+// turn and 200 once they run out.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	payloads []string
+	received chan struct{}
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, string) {
+	rcv := &receiver{statuses: statuses, received: make(chan struct{}, 10)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		status := http.StatusOK
+		if len(rcv.statuses) > 0 {
+			status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+		}
+		if status == http.StatusOK {
+			rcv.payloads = append(rcv.payloads, string(body))
+		}
+		rcv.mu.Unlock()
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			rcv.received <- struct{}{}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return rcv, srv.URL
+}
+
+func (r *receiver) wait(t *testing.T, n int) []string {
+	t.Helper()
+	for range n {
+		select {
+		case <-r.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for notification")
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.payloads...)
+}
+
+func startNotifier(t *testing.T, hooks []Webhook, opts Options) *Notifier {
+	n := New(hooks, opts, logr.Discard())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = n.Start(ctx) }()
+	return n
+}
+
+func mustWebhook(t *testing.T, url, format, tmpl string) Webhook {
+	t.Helper()
+	hook, err := NewWebhook(url, format, tmpl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hook
+}
+
+func TestWebhookFormats(t *testing.T) {
+	applied := Event{Source: "cloudflared/cloudflared", Created: []string{"a.example.com"}, Deleted: []string{"b.example.com"}}
+	tests := []struct {
+		name   string
+		format string
+		tmpl   string
+		want   string
+	}{
+		{
+			name:   "slack",
+			format: FormatSlack,
+			want:   `{"text":":white_check_mark: cloudflared/cloudflared: created a.example.com; deleted b.example.com"}`,
+		},
+		{
+			name:   "template",
+			format: FormatGeneric,
+			tmpl:   `{"source":{{json .Source}},"hosts":{{json (join .Created " ")}}}`,
+			want:   `{"source":"cloudflared/cloudflared","hosts":"a.example.com"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv, url := newReceiver(t)
+			n := startNotifier(t, []Webhook{mustWebhook(t, url, tt.format, tt.tmpl)}, Options{})
+			n.Applied(applied)
+			if got := rcv.wait(t, 1); got[0] != tt.want {
+				t.Errorf("payload = %s, want %s", got[0], tt.want)
+			}
+		})
+	}
+
+	t.Run("generic", func(t *testing.T) {
+		rcv, url := newReceiver(t)
+		n := startNotifier(t, []Webhook{mustWebhook(t, url, "", "")}, Options{})
+		n.Applied(applied)
+		var got Event
+		if err := json.Unmarshal([]byte(rcv.wait(t, 1)[0]), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Kind != KindApplied || got.Source != applied.Source || got.Time.IsZero() || len(got.Created) != 1 {
+			t.Errorf("event = %+v", got)
+		}
+	})
+}
+
+func TestNewWebhookErrors(t *testing.T) {
+	for _, tt := range []struct{ url, format, tmpl string }{
+		{url: "/relative"},
+		{url: "https://example.com", format: "teams"},
+		{url: "https://example.com", tmpl: "{{"},
+	} {
+		if _, err := NewWebhook(tt.url, tt.format, tt.tmpl, nil); err == nil {
+			t.Errorf("NewWebhook(%q, %q, %q) succeeded", tt.url, tt.format, tt.tmpl)
+		}
+	}
+	hook := mustWebhook(t, "https://example.com", "", "not json")
+	if _, err := hook.Render(Event{}); err == nil {
+		t.Error("rendering a template that is not JSON succeeded")
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	rcv, url := newReceiver(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	n := startNotifier(t, []Webhook{mustWebhook(t, url, "", "")}, Options{RetryDelay: time.Millisecond})
+	n.Applied(Event{Source: "a", Created: []string{"a.example.com"}})
+	if got := rcv.wait(t, 1); len(got) != 1 {
+		t.Errorf("payloads = %v", got)
+	}
+
+	rcv, url = newReceiver(t, http.StatusBadRequest)
+	n = New([]Webhook{mustWebhook(t, url, "", "")}, Options{RetryDelay: time.Millisecond}, logr.Discard())
+	if err := n.send(context.Background(), n.webhooks[0], Event{}); err == nil {
+		t.Error("send succeeded on 400")
+	}
+	if len(rcv.statuses) != 0 || len(rcv.payloads) != 0 {
+		t.Errorf("400 was retried")
+	}
+}
+
+func TestNotifierFailuresAndDedup(t *testing.T) {
+	rcv, url := newReceiver(t)
+	n := startNotifier(t, []Webhook{mustWebhook(t, url, FormatSlack, "")}, Options{FailureThreshold: 2, DedupWindow: time.Hour})
+	now := time.Now()
+	n.now = func() time.Time { return now }
+
+	errBoom := errors.New("boom")
+	n.Failed("a", errBoom) // below the threshold
+	n.Failed("a", errBoom) // reported
+	n.Failed("a", errBoom) // duplicate
+	n.Succeeded("a")       // resets the count
+	n.Failed("a", errBoom) // below the threshold
+	now = now.Add(2 * time.Hour)
+	n.Failed("a", errBoom) // reported again after the dedup window
+	n.Applied(Event{Source: "b", Updated: []string{"b.example.com"}})
+	n.Applied(Event{Source: "b", Updated: []string{"b.example.com"}})
+
+	got := rcv.wait(t, 3)
+	want := []string{
+		`{"text":":warning: a failed 2 times in a row: boom"}`,
+		`{"text":":warning: a failed 2 times in a row: boom"}`,
+		`{"text":":white_check_mark: b: updated b.example.com"}`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("payloads = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("payload %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+	select {
+	case <-rcv.received:
+		t.Errorf("unexpected notification: %v", rcv.payloads)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNilNotifier(t *testing.T) {
+	var n *Notifier
+	n.Applied(Event{})
+	n.Failed("a", errors.New("boom"))
+	n.Succeeded("a")
+}
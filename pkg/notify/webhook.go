@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Webhook formats.
+const (
+	FormatGeneric = "generic"
+	FormatSlack   = "slack"
+)
+
+// Webhook is an HTTP endpoint events are POSTed to as JSON. Generic webhooks
+// receive the Event itself and Slack ones a message with its Summary, unless
+// a template renders the payload instead.
+type Webhook struct {
+	url      string
+	format   string
+	template *template.Template
+	client   *http.Client
+}
+
+var templateFuncs = template.FuncMap{
+	// json encodes a value, such as a string to embed in the payload.
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join": strings.Join,
+}
+
+// NewWebhook returns a webhook posting to rawURL in format. tmpl, if not
+// empty, is a text/template executed with the Event that must render JSON.
+func NewWebhook(rawURL, format, tmpl string, client *http.Client) (Webhook, error) {
+	if u, err := url.Parse(rawURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return Webhook{}, errors.New("webhook URL must be absolute")
+	}
+	switch format {
+	case "":
+		format = FormatGeneric
+	case FormatGeneric, FormatSlack:
+	default:
+		return Webhook{}, fmt.Errorf("webhook format must be %s or %s, got %q", FormatGeneric, FormatSlack, format)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	hook := Webhook{url: rawURL, format: format, client: client}
+	if tmpl != "" {
+		t, err := template.New("webhook").Funcs(templateFuncs).Parse(tmpl)
+		if err != nil {
+			return Webhook{}, fmt.Errorf("invalid webhook template: %w", err)
+		}
+		hook.template = t
+	}
+	return hook, nil
+}
+
+// Name identifies the webhook in logs without leaking the secret part of its URL.
+func (w Webhook) Name() string {
+	u, err := url.Parse(w.url)
+	if err != nil {
+		return w.format
+	}
+	return w.format + " " + u.Host
+}
+
+// Render returns the payload of ev.
+func (w Webhook) Render(ev Event) ([]byte, error) {
+	if w.template != nil {
+		var buf bytes.Buffer
+		if err := w.template.Execute(&buf, ev); err != nil {
+			return nil, fmt.Errorf("unable to render webhook template: %w", err)
+		}
+		if !json.Valid(buf.Bytes()) {
+			return nil, fmt.Errorf("webhook template did not render JSON: %s", buf.String())
+		}
+		return buf.Bytes(), nil
+	}
+	if w.format == FormatSlack {
+		text := ":white_check_mark: " + ev.Summary()
+		if ev.Kind == KindFailed {
+			text = ":warning: " + ev.Summary()
+		}
+		return json.Marshal(map[string]string{"text": text})
+	}
+	return json.Marshal(ev)
+}
+
+// post sends body once and reports whether a failure is worth retrying.
+func (w Webhook) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("webhook answered %s", resp.Status)
+}
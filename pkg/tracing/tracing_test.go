@@ -0,0 +1,18 @@
+package tracing
+
+import "testing"
+
+func TestConfigEnabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if (Config{}).Enabled() {
+		t.Error("tracing should be disabled without an endpoint")
+	}
+	if !(Config{Endpoint: "http://collector:4317"}).Enabled() {
+		t.Error("tracing should be enabled with an endpoint")
+	}
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://collector:4317")
+	if !(Config{}).Enabled() {
+		t.Error("tracing should be enabled by OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	}
+}
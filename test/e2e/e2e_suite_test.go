@@ -34,6 +34,8 @@ import (
 var (
 	// managerImage is the manager image to be built and loaded for testing.
 	managerImage = "example.com/cloudflared-dns-controller:v0.0.1"
+	// emulatorImage is the Cloudflare API emulator image the controller talks to.
+	emulatorImage = "example.com/cfemulator:v0.0.1"
 	// shouldCleanupCertManager tracks whether CertManager was installed by this suite.
 	shouldCleanupCertManager = false
 )
@@ -60,6 +62,13 @@ var _ = BeforeSuite(func() {
 	err = utils.LoadImageToKindClusterWithName(managerImage)
 	ExpectWithOffset(1, err).NotTo(HaveOccurred(), "Failed to load the manager image into Kind")
 
+	By("building and loading the Cloudflare API emulator image")
+	cmd = exec.Command("make", "docker-build-cfemulator", fmt.Sprintf("EMULATOR_IMG=%s", emulatorImage))
+	_, err = utils.Run(cmd)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred(), "Failed to build the emulator image")
+	err = utils.LoadImageToKindClusterWithName(emulatorImage)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred(), "Failed to load the emulator image into Kind")
+
 	setupCertManager()
 })
 
@@ -45,6 +45,9 @@ const metricsServiceName = "cloudflared-dns-controller-controller-manager-metric
 // metricsRoleBindingName is the name of the RBAC that will be created to allow get the metrics data
 const metricsRoleBindingName = "cloudflared-dns-controller-metrics-binding"
 
+// emulatorURL is the in-cluster address of the Cloudflare API emulator.
+const emulatorURL = "http://cfemulator." + namespace + ".svc.cluster.local:8787/client/v4"
+
 var _ = Describe("Manager", Ordered, func() {
 	var controllerPodName string
 
@@ -68,20 +71,33 @@ var _ = Describe("Manager", Ordered, func() {
 		_, err = utils.Run(cmd)
 		Expect(err).NotTo(HaveOccurred(), "Failed to install CRDs")
 
-		By("creating dummy cloudflare credentials secret for testing")
+		By("creating cloudflare credentials for the emulator")
 		cmd = exec.Command("kubectl", "create", "secret", "generic",
 			"cloudflare-credentials",
-			"--from-literal=api-token=dummy-token",
-			"--from-literal=zone-id=dummy-zone-id",
+			"--from-literal=api-token=e2e-token",
+			"--from-literal=zone-id=e2e-zone",
 			"-n", namespace,
 		)
 		_, err = utils.Run(cmd)
 		Expect(err).NotTo(HaveOccurred(), "Failed to create cloudflare credentials secret")
 
+		By("deploying the Cloudflare API emulator")
+		cmd = exec.Command("kubectl", "apply", "-f", "test/e2e/testdata/cfemulator.yaml", "-n", namespace)
+		_, err = utils.Run(cmd)
+		Expect(err).NotTo(HaveOccurred(), "Failed to deploy the Cloudflare API emulator")
+
 		By("deploying the controller-manager")
 		cmd = exec.Command("make", "deploy", fmt.Sprintf("IMG=%s", managerImage))
 		_, err = utils.Run(cmd)
 		Expect(err).NotTo(HaveOccurred(), "Failed to deploy the controller-manager")
+
+		By("pointing the controller-manager at the emulator")
+		cmd = exec.Command("kubectl", "patch", "deployment", "cloudflared-dns-controller-controller-manager",
+			"-n", namespace, "--type=json", "-p", fmt.Sprintf(
+				`[{"op":"add","path":"/spec/template/spec/containers/0/args/-","value":"--cloudflare-base-url=%s"}]`,
+				emulatorURL))
+		_, err = utils.Run(cmd)
+		Expect(err).NotTo(HaveOccurred(), "Failed to point the controller-manager at the emulator")
 	})
 
 	// After all tests have been executed, clean up by undeploying the controller, uninstalling CRDs,
@@ -91,6 +107,10 @@ var _ = Describe("Manager", Ordered, func() {
 		cmd := exec.Command("kubectl", "delete", "pod", "curl-metrics", "-n", namespace)
 		_, _ = utils.Run(cmd)
 
+		By("removing the target ConfigMap")
+		cmd = exec.Command("kubectl", "delete", "ns", "cloudflared", "--ignore-not-found")
+		_, _ = utils.Run(cmd)
+
 		By("undeploying the controller-manager")
 		cmd = exec.Command("make", "undeploy")
 		_, _ = utils.Run(cmd)
@@ -276,6 +296,71 @@ var _ = Describe("Manager", Ordered, func() {
 			Eventually(verifyMetricsAvailable, 2*time.Minute).Should(Succeed())
 		})
 
+		It("should create DNS records for the target ConfigMap", func() {
+			By("creating the target ConfigMap")
+			cmd := exec.Command("kubectl", "create", "ns", "cloudflared")
+			_, _ = utils.Run(cmd)
+			cmd = exec.Command("kubectl", "apply", "-f", "test/e2e/testdata/cloudflared-configmap.yaml")
+			_, err := utils.Run(cmd)
+			Expect(err).NotTo(HaveOccurred(), "Failed to create the target ConfigMap")
+
+			By("reading the records from the emulator")
+			verifyRecordCreated := func(g Gomega) {
+				cmd := exec.Command("kubectl", "get", "--raw", fmt.Sprintf(
+					"/api/v1/namespaces/%s/services/http:cfemulator:8787/proxy/client/v4/zones/e2e-zone/dns_records",
+					namespace))
+				output, err := utils.Run(cmd)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(output).To(ContainSubstring(`"name":"app.example.com"`))
+				g.Expect(output).To(ContainSubstring("6ff42ae2-765d-4adf-8112-31c55c1551ef.cfargotunnel.com"))
+			}
+			Eventually(verifyRecordCreated).Should(Succeed())
+		})
+
+		It("should create DNS records through injected Cloudflare rate limits", func() {
+			By("injecting rate limits for record changes into the emulator")
+			faultsPath := fmt.Sprintf("/api/v1/namespaces/%s/services/http:cfemulator:8787/proxy/__emulator/faults", namespace)
+			faultFile := filepath.Join("/tmp", "cfemulator-fault.json")
+			fault := `{"method":"POST","pathPrefix":"/zones/e2e-zone/dns_records","status":429,"retryAfter":"2s","times":2}`
+			Expect(os.WriteFile(faultFile, []byte(fault), os.FileMode(0o644))).To(Succeed())
+			cmd := exec.Command("kubectl", "create", "--raw", faultsPath, "-f", faultFile)
+			_, err := utils.Run(cmd)
+			Expect(err).NotTo(HaveOccurred(), "Failed to inject the fault")
+
+			By("adding a hostname to the target ConfigMap")
+			config := map[string]any{"data": map[string]string{"config.yaml": `tunnel: 6ff42ae2-765d-4adf-8112-31c55c1551ef
+
+ingress:
+- hostname: app.example.com
+  service: http://app.default.svc.cluster.local:80
+- hostname: api.example.com
+  service: http://api.default.svc.cluster.local:80
+- service: http_status:404
+`}}
+			patch, err := json.Marshal(config)
+			Expect(err).NotTo(HaveOccurred())
+			cmd = exec.Command("kubectl", "patch", "configmap", "cloudflared", "-n", "cloudflared",
+				"--type", "merge", "-p", string(patch))
+			_, err = utils.Run(cmd)
+			Expect(err).NotTo(HaveOccurred(), "Failed to patch the target ConfigMap")
+
+			By("waiting for the record to be created once the rate limits are used up")
+			verifyRecordCreated := func(g Gomega) {
+				cmd := exec.Command("kubectl", "get", "--raw", fmt.Sprintf(
+					"/api/v1/namespaces/%s/services/http:cfemulator:8787/proxy/client/v4/zones/e2e-zone/dns_records",
+					namespace))
+				output, err := utils.Run(cmd)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(output).To(ContainSubstring(`"name":"api.example.com"`))
+
+				cmd = exec.Command("kubectl", "get", "--raw", faultsPath)
+				output, err = utils.Run(cmd)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(output).To(ContainSubstring(`"result":[]`), "the injected faults were not hit")
+			}
+			Eventually(verifyRecordCreated, 2*time.Minute).Should(Succeed())
+		})
+
 		// +kubebuilder:scaffold:e2e-webhooks-checks
 
 		// TODO: Customize the e2e test suite with scenarios specific to your project.